@@ -0,0 +1,152 @@
+package analysis_test
+
+import (
+	"github.com/pflow-xyz/go-metamodel/analysis"
+	"github.com/pflow-xyz/go-metamodel/metamodel"
+	"testing"
+)
+
+func workflowDeclaration(m metamodel.Declaration) {
+	cell, fn := m.Cell, m.Fn
+
+	start := cell().Label("start").Initial(1)
+	pending := cell().Label("pending")
+	done := cell().Label("done")
+
+	submit := fn().Label("submit")
+	approve := fn().Label("approve")
+	reject := fn().Label("reject")
+
+	start.Tx(1, submit)
+	submit.Tx(1, pending)
+	pending.Tx(1, approve)
+	approve.Tx(1, done)
+	pending.Tx(1, reject)
+	reject.Tx(1, start)
+}
+
+func TestReachability(t *testing.T) {
+	mm := metamodel.New().Define(workflowDeclaration)
+	g := analysis.Reachability(mm.Net(), nil)
+	if !g.Complete {
+		t.Fatalf("expected complete graph")
+	}
+	if len(g.States) != 3 {
+		t.Fatalf("expected 3 states got %v", g.States)
+	}
+	done := mm.Net().Places["done"].Offset
+	path, ok := g.Find(func(v metamodel.Vector) bool { return v[done] == 1 })
+	if !ok {
+		t.Fatalf("expected done to be reachable")
+	}
+	if len(path) != 2 || path[0] != "submit" || path[1] != "approve" {
+		t.Fatalf("unexpected path %v", path)
+	}
+}
+
+func TestReachabilityBound(t *testing.T) {
+	mm := metamodel.New().Define(func(m metamodel.Declaration) {
+		m.Fn().Label("inc").Tx(1, m.Cell().Label("counter"))
+	})
+	g := analysis.Reachability(mm.Net(), nil, 10)
+	if g.Complete {
+		t.Fatalf("expected bound to be reached")
+	}
+	if len(g.States) != 10 {
+		t.Fatalf("expected 10 states got %v", len(g.States))
+	}
+}
+
+func TestCoverability(t *testing.T) {
+	mm := metamodel.New().Define(func(m metamodel.Declaration) {
+		ready := m.Cell().Label("ready").Initial(1)
+		idle := m.Cell().Label("idle")
+		produce := m.Fn().Label("produce")
+		reset := m.Fn().Label("reset")
+		ready.Tx(1, produce)
+		produce.Tx(1, idle)
+		produce.Tx(1, m.Cell().Label("buffer"))
+		idle.Tx(1, reset)
+		reset.Tx(1, ready)
+	})
+	tree := analysis.Coverability(mm.Net(), nil)
+	if !tree.Complete {
+		t.Fatalf("expected complete tree")
+	}
+	unbounded := tree.Unbounded()
+	if len(unbounded) != 1 || unbounded[0] != "buffer" {
+		t.Fatalf("expected buffer to be unbounded got %v", unbounded)
+	}
+	if max, ok := tree.Bound("ready"); !ok || max != 1 {
+		t.Fatalf("expected ready to be 1-bounded got %v", max)
+	}
+
+	wf := metamodel.New().Define(workflowDeclaration)
+	if !analysis.Coverability(wf.Net(), nil).Bounded() {
+		t.Fatalf("expected workflow to be bounded")
+	}
+	// three distinct markings, the fourth node only returns to start
+	if tree := analysis.Coverability(wf.Net(), nil, 3); !tree.Complete {
+		t.Fatalf("expected duplicates not to count towards the bound got %v", tree.Nodes)
+	}
+	if tree := analysis.Coverability(wf.Net(), nil, 2); tree.Complete {
+		t.Fatalf("expected a smaller bound to truncate the tree")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	mm := metamodel.New().Define(workflowDeclaration, func(m metamodel.Declaration) {
+		m.Cell().Label("never").Tx(1, m.Fn().Label("orphan"))
+	})
+	report := analysis.Check(mm.Net(), nil)
+	if report.Ok() {
+		t.Fatalf("expected problems to be reported")
+	}
+	if len(report.Deadlocks) != 1 {
+		t.Fatalf("expected a single deadlock got %v", report.Deadlocks)
+	}
+	path := report.Deadlocks[0].Path
+	if len(path) != 2 || path[1] != "approve" {
+		t.Fatalf("unexpected path %v", path)
+	}
+	if len(report.DeadTransitions) != 1 || report.DeadTransitions[0] != "orphan" {
+		t.Fatalf("expected orphan to be dead got %v", report.DeadTransitions)
+	}
+}
+
+func TestInvariants(t *testing.T) {
+	mm := metamodel.New().Define(workflowDeclaration)
+	net := mm.Net()
+	pinv := analysis.PlaceInvariants(net)
+	if len(pinv) != 1 || len(pinv[0]) != 3 {
+		t.Fatalf("expected a single invariant covering all places got %v", pinv)
+	}
+	g := analysis.Reachability(net, nil)
+	for _, s := range g.States {
+		if pinv[0].Value(net, s) != 1 {
+			t.Fatalf("invariant violated by %v", s)
+		}
+	}
+	tinv := analysis.TransitionInvariants(net)
+	if len(tinv) != 1 || tinv[0]["submit"] != 1 || tinv[0]["reject"] != 1 || tinv[0]["approve"] != 0 {
+		t.Fatalf("expected submit/reject cycle got %v", tinv)
+	}
+
+	approval := metamodel.New().Define(workflowDeclaration).Net()
+	nested := metamodel.New().Define(func(m metamodel.Declaration) {
+		in := m.Cell().Label("in").Initial(1)
+		out := m.Cell().Label("out")
+		review := m.Fn().Label("review").Subnet("approval", approval, map[string]string{"start": "in", "done": "out"})
+		in.Tx(1, review)
+		review.Tx(1, out)
+	}).Net()
+	if actions := analysis.Actions(nested); len(actions) != 0 {
+		t.Fatalf("expected substitution transitions to be left out got %v", actions)
+	}
+	if tree := analysis.Coverability(nested, nil); len(tree.Nodes) != 1 {
+		t.Fatalf("expected substitution transition not to fire got %v", tree.Nodes)
+	}
+	if tinv := analysis.TransitionInvariants(nested); len(tinv) != 0 {
+		t.Fatalf("expected no transition invariants got %v", tinv)
+	}
+}
@@ -0,0 +1,165 @@
+package analysis
+
+import (
+	"fmt"
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"math"
+	"sort"
+)
+
+// Omega marks a place that can hold an arbitrarily large number of tokens
+const Omega int64 = math.MaxInt64
+
+// CoverNode is a marking in a coverability tree
+type CoverNode struct {
+	Marking   Vector `json:"marking"`
+	Parent    int    `json:"parent"`
+	Action    string `json:"action"`
+	Duplicate bool   `json:"duplicate"`
+}
+
+// CoverabilityTree is a Karp-Miller tree where unbounded places are accelerated to Omega
+// places with a capacity are never accelerated and inhibitor guards over Omega places
+// are assumed not to inhibit, so the tree over-approximates the reachable markings
+type CoverabilityTree struct {
+	Net      *PetriNet   `json:"-"`
+	Nodes    []CoverNode `json:"nodes"`
+	Complete bool        `json:"complete"`
+}
+
+// Coverability builds the Karp-Miller tree of a net starting from the initial vector
+func Coverability(net *PetriNet, initial Vector, maxNodes ...int) *CoverabilityTree {
+	bound := DefaultBound
+	if len(maxNodes) == 1 {
+		bound = maxNodes[0]
+	} else if len(maxNodes) > 1 {
+		panic(fmt.Sprintf(UnexpectedArguments, 1, len(maxNodes)))
+	}
+	if len(initial) == 0 {
+		initial = net.InitialVector()
+	}
+	tree := &CoverabilityTree{
+		Net:      net,
+		Nodes:    []CoverNode{{Marking: initial, Parent: -1}},
+		Complete: true,
+	}
+	actions := Actions(net)
+	capacity := net.CapacityVector()
+	seen := map[string]bool{key(initial): true}
+	for i := 0; i < len(tree.Nodes); i++ {
+		if tree.Nodes[i].Duplicate {
+			continue
+		}
+		for _, action := range actions {
+			ok, out := coverFire(tree.Nodes[i].Marking, net.Transitions[action], capacity)
+			if !ok {
+				continue
+			}
+			tree.accelerate(i, out, capacity)
+			// duplicates are leaves, only new markings count towards the bound
+			k := key(out)
+			if seen[k] {
+				tree.Nodes = append(tree.Nodes, CoverNode{Marking: out, Parent: i, Action: action, Duplicate: true})
+				continue
+			}
+			if len(seen) >= bound {
+				tree.Complete = false
+				return tree
+			}
+			seen[k] = true
+			tree.Nodes = append(tree.Nodes, CoverNode{Marking: out, Parent: i, Action: action})
+		}
+	}
+	return tree
+}
+
+// accelerate promotes places that strictly grow over an ancestor marking to Omega
+func (tree *CoverabilityTree) accelerate(parent int, out Vector, capacity Vector) {
+	for a := parent; a >= 0; a = tree.Nodes[a].Parent {
+		if !covers(out, tree.Nodes[a].Marking) {
+			continue
+		}
+		for i, v := range tree.Nodes[a].Marking {
+			if out[i] > v && capacity[i] == 0 {
+				out[i] = Omega
+			}
+		}
+	}
+}
+
+func covers(m Vector, other Vector) bool {
+	for i, v := range other {
+		if m[i] < v {
+			return false
+		}
+	}
+	return true
+}
+
+func coverFire(m Vector, txn *Transition, capacity Vector) (ok bool, out Vector) {
+	for _, g := range txn.Guards {
+		for i, d := range g.Delta {
+			if d == 0 || m[i] == Omega {
+				continue
+			}
+			if g.Inverted && m[i] < -d {
+				return false, nil
+			}
+			if !g.Inverted && m[i] >= -d {
+				return false, nil
+			}
+		}
+	}
+	out = make(Vector, len(m))
+	for i, v := range m {
+		if v == Omega {
+			out[i] = Omega
+			continue
+		}
+		out[i] = v + txn.Delta[i]
+		if out[i] < 0 {
+			return false, nil
+		}
+		if capacity[i] > 0 && out[i] > capacity[i] {
+			return false, nil
+		}
+	}
+	return true, out
+}
+
+// Unbounded lists labels of places that reach Omega
+func (tree *CoverabilityTree) Unbounded() []string {
+	labels := []string{}
+	for label, p := range tree.Net.Places {
+		for _, n := range tree.Nodes {
+			if n.Marking[p.Offset] == Omega {
+				labels = append(labels, label)
+				break
+			}
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// Bounded is true when no place can grow without limit
+func (tree *CoverabilityTree) Bounded() bool {
+	return len(tree.Unbounded()) == 0
+}
+
+// Bound returns the maximum token count observed for a place, ok is false when the place is unbounded
+func (tree *CoverabilityTree) Bound(label string) (max int64, ok bool) {
+	p := tree.Net.Places[label]
+	if p == nil {
+		panic(ExpectedPlace)
+	}
+	for _, n := range tree.Nodes {
+		if n.Marking[p.Offset] == Omega {
+			return Omega, false
+		}
+		if n.Marking[p.Offset] > max {
+			max = n.Marking[p.Offset]
+		}
+	}
+	return max, true
+}
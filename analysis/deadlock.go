@@ -0,0 +1,60 @@
+package analysis
+
+import (
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"github.com/pflow-xyz/go-metamodel/vasm"
+)
+
+// Deadlock is a reachable marking where no transition is enabled
+type Deadlock struct {
+	Marking Vector   `json:"marking"`
+	Path    []string `json:"path"`
+}
+
+// Report collects liveness problems found in a state space
+type Report struct {
+	Deadlocks       []Deadlock `json:"deadlocks"`
+	DeadTransitions []string   `json:"deadTransitions"`
+	Complete        bool       `json:"complete"`
+}
+
+// Ok is true when the full state space was explored without finding dead markings or dead transitions
+func (r Report) Ok() bool {
+	return r.Complete && len(r.Deadlocks) == 0 && len(r.DeadTransitions) == 0
+}
+
+// Check explores the state space of a net and reports deadlocks and transitions that can never fire
+func Check(net *PetriNet, initial Vector, maxStates ...int) Report {
+	return Reachability(net, initial, maxStates...).Check()
+}
+
+// Check reports dead markings with the firing sequence that reaches them and transitions that are never enabled
+func (g *Graph) Check() Report {
+	report := Report{
+		Deadlocks:       []Deadlock{},
+		DeadTransitions: []string{},
+		Complete:        g.Complete,
+	}
+	actions := Actions(g.Net)
+	fired := map[string]bool{}
+	capacity := g.Net.CapacityVector()
+	for i, s := range g.States {
+		p := vasm.Execute(g.Net, s, capacity)
+		dead := true
+		for _, action := range actions {
+			if ok, _, _ := p.TestFire(Op{Action: action, Multiple: 1}); ok {
+				fired[action] = true
+				dead = false
+			}
+		}
+		if dead {
+			report.Deadlocks = append(report.Deadlocks, Deadlock{Marking: s, Path: g.Path(i)})
+		}
+	}
+	for _, action := range actions {
+		if !fired[action] {
+			report.DeadTransitions = append(report.DeadTransitions, action)
+		}
+	}
+	return report
+}
@@ -0,0 +1,193 @@
+package analysis
+
+import (
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"sort"
+)
+
+// Invariant assigns a positive weight to place or transition labels
+type Invariant map[string]int64
+
+// IncidenceMatrix returns a row per place ordered by offset and a column per transition ordered by Actions
+func IncidenceMatrix(net *PetriNet) [][]int64 {
+	actions := Actions(net)
+	matrix := make([][]int64, len(net.Places))
+	for i := range matrix {
+		matrix[i] = make([]int64, len(actions))
+	}
+	for j, action := range actions {
+		for i, d := range net.Transitions[action].Delta {
+			matrix[i][j] = d
+		}
+	}
+	return matrix
+}
+
+// PlaceInvariants computes minimal semi-positive P-invariants
+// the weighted token sum of each invariant is constant in every reachable marking
+func PlaceInvariants(net *PetriNet) []Invariant {
+	labels := make([]string, len(net.Places))
+	for label, p := range net.Places {
+		labels[p.Offset] = label
+	}
+	return toInvariants(farkas(IncidenceMatrix(net)), labels)
+}
+
+// TransitionInvariants computes minimal semi-positive T-invariants
+// firing each transition as many times as its weight reproduces the starting marking
+func TransitionInvariants(net *PetriNet) []Invariant {
+	matrix := IncidenceMatrix(net)
+	actions := Actions(net)
+	transposed := make([][]int64, len(actions))
+	for j := range transposed {
+		transposed[j] = make([]int64, len(matrix))
+		for i := range matrix {
+			transposed[j][i] = matrix[i][j]
+		}
+	}
+	return toInvariants(farkas(transposed), actions)
+}
+
+// Value computes the weighted token sum of a P-invariant for a marking
+func (inv Invariant) Value(net *PetriNet, v Vector) (sum int64) {
+	for label, w := range inv {
+		p := net.Places[label]
+		if p == nil {
+			panic(ExpectedPlace)
+		}
+		sum += w * v[p.Offset]
+	}
+	return sum
+}
+
+// Labels returns the support of the invariant in sorted order
+func (inv Invariant) Labels() []string {
+	labels := make([]string, 0, len(inv))
+	for label := range inv {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func toInvariants(rows [][]int64, labels []string) []Invariant {
+	out := []Invariant{}
+	for _, r := range rows {
+		inv := Invariant{}
+		for i, w := range r {
+			if w != 0 {
+				inv[labels[i]] = w
+			}
+		}
+		out = append(out, inv)
+	}
+	return out
+}
+
+// farkas solves x >= 0, x * matrix = 0 by exact integer elimination and returns minimal support solutions
+func farkas(matrix [][]int64) [][]int64 {
+	n := len(matrix)
+	if n == 0 {
+		return [][]int64{}
+	}
+	cols := len(matrix[0])
+	rows := make([][]int64, n)
+	for i, r := range matrix {
+		rows[i] = make([]int64, cols+n)
+		copy(rows[i], r)
+		rows[i][cols+i] = 1
+	}
+	for j := 0; j < cols; j++ {
+		next := [][]int64{}
+		for _, r := range rows {
+			if r[j] == 0 {
+				next = append(next, r)
+			}
+		}
+		for a := 0; a < len(rows); a++ {
+			for b := a + 1; b < len(rows); b++ {
+				if rows[a][j]*rows[b][j] >= 0 {
+					continue
+				}
+				ka, kb := abs(rows[b][j]), abs(rows[a][j])
+				r := make([]int64, cols+n)
+				for k := range r {
+					r[k] = ka*rows[a][k] + kb*rows[b][k]
+				}
+				next = append(next, normalize(r))
+			}
+		}
+		rows = minimal(next, cols)
+	}
+	out := make([][]int64, len(rows))
+	for i, r := range rows {
+		out[i] = r[cols:]
+	}
+	return out
+}
+
+// minimal drops duplicate rows and rows whose support strictly contains the support of another row
+func minimal(rows [][]int64, cols int) [][]int64 {
+	out := [][]int64{}
+	for a, r := range rows {
+		keep := true
+		for b, other := range rows {
+			if a == b || !supportContains(r[cols:], other[cols:]) {
+				continue
+			}
+			if !supportContains(other[cols:], r[cols:]) || (b < a && equal(r, other)) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func supportContains(r []int64, other []int64) bool {
+	for i, v := range other {
+		if v != 0 && r[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func equal(r []int64, other []int64) bool {
+	for i, v := range r {
+		if other[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func normalize(r []int64) []int64 {
+	var d int64 = 0
+	for _, v := range r {
+		d = gcd(d, abs(v))
+	}
+	if d > 1 {
+		for i := range r {
+			r[i] /= d
+		}
+	}
+	return r
+}
+
+func gcd(a int64, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
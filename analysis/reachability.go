@@ -0,0 +1,145 @@
+package analysis
+
+import (
+	"fmt"
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"github.com/pflow-xyz/go-metamodel/vasm"
+	"sort"
+)
+
+// DefaultBound limits the number of markings explored when no bound is given
+const DefaultBound = 10000
+
+// Edge connects two markings by firing a transition
+type Edge struct {
+	Source int    `json:"source"`
+	Target int    `json:"target"`
+	Action string `json:"action"`
+}
+
+// Graph is the state space of a net reachable from an initial marking
+type Graph struct {
+	Net      *PetriNet `json:"-"`
+	States   []Vector  `json:"states"`
+	Edges    []Edge    `json:"edges"`
+	Complete bool      `json:"complete"`
+	parent   []int
+	index    map[string]int
+}
+
+func key(v Vector) string {
+	return fmt.Sprint(v)
+}
+
+// Actions returns the labels of transitions that can fire in a stable order
+// substitution transitions only fire in the flattened net so every analysis leaves them out
+func Actions(net *PetriNet) []string {
+	labels := make([]string, 0, len(net.Transitions))
+	for label, txn := range net.Transitions {
+		if !txn.IsSubstitution() {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// Reachability explores every marking reachable from the initial vector using vasm firing rules
+// exploration stops after maxStates markings and the graph is marked incomplete
+func Reachability(net *PetriNet, initial Vector, maxStates ...int) *Graph {
+	bound := DefaultBound
+	if len(maxStates) == 1 {
+		bound = maxStates[0]
+	} else if len(maxStates) > 1 {
+		panic(fmt.Sprintf(UnexpectedArguments, 1, len(maxStates)))
+	}
+	if len(initial) == 0 {
+		initial = net.InitialVector()
+	}
+	g := &Graph{
+		Net:      net,
+		States:   []Vector{},
+		Edges:    []Edge{},
+		Complete: true,
+		parent:   []int{},
+		index:    map[string]int{},
+	}
+	g.add(initial, -1)
+	actions := Actions(net)
+	capacity := net.CapacityVector()
+	for i := 0; i < len(g.States); i++ {
+		p := vasm.Execute(net, g.States[i], capacity)
+		for _, action := range actions {
+			ok, _, out := p.TestFire(Op{Action: action, Multiple: 1})
+			if !ok {
+				continue
+			}
+			target, found := g.Index(out)
+			if !found {
+				if len(g.States) >= bound {
+					g.Complete = false
+					continue
+				}
+				target = g.add(out, i)
+			}
+			g.Edges = append(g.Edges, Edge{Source: i, Target: target, Action: action})
+		}
+	}
+	return g
+}
+
+func (g *Graph) add(v Vector, parent int) int {
+	i := len(g.States)
+	g.States = append(g.States, v)
+	g.parent = append(g.parent, parent)
+	g.index[key(v)] = i
+	return i
+}
+
+// Index returns the position of a marking in the graph
+func (g *Graph) Index(v Vector) (i int, ok bool) {
+	i, ok = g.index[key(v)]
+	return i, ok
+}
+
+// Successors lists edges leaving a marking
+func (g *Graph) Successors(i int) (edges []Edge) {
+	for _, e := range g.Edges {
+		if e.Source == i {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// Path returns the shortest firing sequence from the initial marking to state i
+func (g *Graph) Path(i int) []string {
+	path := []string{}
+	for i > 0 {
+		p := g.parent[i]
+		for _, e := range g.Edges {
+			if e.Source == p && e.Target == i {
+				path = append([]string{e.Action}, path...)
+				break
+			}
+		}
+		i = p
+	}
+	return path
+}
+
+// Find searches for a reachable marking matching the predicate and returns the firing sequence to reach it
+func (g *Graph) Find(match func(Vector) bool) (path []string, ok bool) {
+	for i, s := range g.States {
+		if match(s) {
+			return g.Path(i), true
+		}
+	}
+	return nil, false
+}
+
+// CanReach tests if a marking is reachable
+func (g *Graph) CanReach(v Vector) bool {
+	_, ok := g.Index(v)
+	return ok
+}
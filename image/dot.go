@@ -0,0 +1,136 @@
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pflow-xyz/go-metamodel/analysis"
+	"github.com/pflow-xyz/go-metamodel/metamodel"
+	"github.com/pflow-xyz/go-metamodel/vasm"
+	"io"
+	"os"
+	"strings"
+)
+
+// DotImage writes models and state spaces in the Graphviz DOT language
+type DotImage struct {
+	stateMachine metamodel.Process
+	writerOut    io.Writer
+	onClose      func()
+}
+
+func NewDotFile(outputPath string) *DotImage {
+	f, err := os.Create(outputPath)
+	if err != nil {
+		panic(err)
+	}
+	w := bufio.NewWriter(f)
+	i := NewDot(w)
+	i.onClose = func() {
+		err := w.Flush()
+		if err != nil {
+			panic(err)
+		}
+	}
+	return i
+}
+
+func NewDot(out io.Writer) *DotImage {
+	i := new(DotImage)
+	i.writerOut = out
+	return i
+}
+
+func (i *DotImage) write(format string, a ...interface{}) {
+	i.writerOut.Write([]byte(fmt.Sprintf(format, a...)))
+}
+
+func (i *DotImage) end() {
+	i.write("}\n")
+	if i.onClose != nil {
+		i.onClose()
+	}
+}
+
+// Render draws places with token counts and transitions coloured by enabledness
+func (i *DotImage) Render(m metamodel.MetaModel, initialVectors ...metamodel.Vector) {
+	net := m.Net()
+	i.stateMachine = vasm.Execute(net, initialVectors...)
+	i.write("digraph %q {\n", net.ModelType)
+	i.write("  rankdir=LR;\n")
+	for _, label := range metamodel.SortedKeys(net.Places) {
+		i.place(net.Places[label])
+	}
+	for _, label := range metamodel.SortedKeys(net.Transitions) {
+		i.transition(net.Transitions[label])
+	}
+	for _, a := range net.Arcs {
+		i.arc(a)
+	}
+	i.end()
+}
+
+func (i *DotImage) place(place *metamodel.Place) {
+	label := place.Label
+	tokens := i.stateMachine.TokenCount(place.Label)
+	if tokens > 0 {
+		label = fmt.Sprintf("%s\n%v", label, tokens)
+	}
+	i.write("  %q [shape=circle label=%q];\n", place.Label, label)
+}
+
+func (i *DotImage) transition(transition *metamodel.Transition) {
+	op := metamodel.Op{Action: transition.Label, Multiple: 1, Role: transition.Role.Label}
+
+	var fill = "#ffffff"
+	{
+		valid, _, _ := i.stateMachine.TestFire(op)
+		inhibited, _ := i.stateMachine.Inhibited(op)
+
+		if !valid && inhibited {
+			fill = "#fab5b0"
+		} else if valid {
+			fill = "#62fa75"
+		}
+	}
+	i.write("  %q [shape=box style=filled fillcolor=%q];\n", transition.Label, fill)
+}
+
+func (i *DotImage) arc(arc metamodel.Arc) {
+	weight := arc.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	head := "normal"
+	if arc.Inhibitor && arc.Read {
+		head = "dot"
+	} else if arc.Inhibitor {
+		head = "odot"
+	}
+	i.write("  %q -> %q [arrowhead=%s label=\"%v\"];\n", metamodel.LabelOf(arc.Source), metamodel.LabelOf(arc.Target), head, weight)
+}
+
+// RenderStateSpace draws each reachable marking as a node and each firing as a labelled edge
+func (i *DotImage) RenderStateSpace(g *analysis.Graph) {
+	labels := make([]string, len(g.Net.Places))
+	for label, p := range g.Net.Places {
+		labels[p.Offset] = label
+	}
+	i.write("digraph \"stateSpace\" {\n")
+	for n, s := range g.States {
+		tokens := []string{}
+		for offset, v := range s {
+			if v != 0 {
+				tokens = append(tokens, fmt.Sprintf("%s=%v", labels[offset], v))
+			}
+		}
+		shape := "ellipse"
+		if n == 0 {
+			shape = "doublecircle"
+		}
+		i.write("  s%v [shape=%s label=%q];\n", n, shape, strings.Join(tokens, "\n"))
+	}
+	for _, e := range g.Edges {
+		i.write("  s%v -> s%v [label=%q];\n", e.Source, e.Target, e.Action)
+	}
+	i.end()
+}
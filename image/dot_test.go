@@ -0,0 +1,31 @@
+package image_test
+
+import (
+	"bytes"
+	"github.com/pflow-xyz/go-metamodel/analysis"
+	"github.com/pflow-xyz/go-metamodel/image"
+	"github.com/pflow-xyz/go-metamodel/model"
+	"github.com/pflow-xyz/go-metamodel/zblob"
+	"strings"
+	"testing"
+)
+
+func TestNewDot(t *testing.T) {
+	zm := new(zblob.Zblob)
+	zm.Base64Zipped = sampleUrl
+	_, mm := model.FromZblob(zm).MetaModel()
+
+	buf := new(bytes.Buffer)
+	image.NewDot(buf).Render(mm)
+	out := buf.String()
+	t.Logf("%s", out)
+	if !strings.HasPrefix(out, "digraph") || !strings.Contains(out, "arrowhead=odot") || !strings.Contains(out, "#62fa75") {
+		t.Fatalf("unexpected dot output")
+	}
+
+	buf.Reset()
+	image.NewDot(buf).RenderStateSpace(analysis.Reachability(mm.Net(), nil, 20))
+	if !strings.Contains(buf.String(), "s0 -> s1") {
+		t.Fatalf("expected state space edges got %s", buf.String())
+	}
+}
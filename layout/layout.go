@@ -0,0 +1,352 @@
+package layout
+
+import (
+	"github.com/pflow-xyz/go-metamodel/metamodel"
+	"math"
+	"sort"
+)
+
+// Layout configures automatic placement
+type Layout struct {
+	Spacing    int64 // distance between layers and between neighbouring elements
+	Iterations int   // rounds of ordering or force simulation
+	KeepFixed  bool  // elements with a non-zero position are not moved
+}
+
+// KeepFixed preserves positions that have already been assigned
+func KeepFixed(l *Layout) {
+	l.KeepFixed = true
+}
+
+type element struct {
+	label string
+	pos   *metamodel.Position
+	fixed bool
+	root  bool
+	x, y  float64
+}
+
+type graph struct {
+	elements []*element
+	edges    [][2]int
+}
+
+func newLayout(opts []func(*Layout)) Layout {
+	l := Layout{Spacing: 80, Iterations: 24}
+	for _, opt := range opts {
+		opt(&l)
+	}
+	return l
+}
+
+// newGraph collects places and transitions in label order connected by flow arcs
+func newGraph(net *metamodel.PetriNet, l Layout) *graph {
+	g := &graph{}
+	index := map[string]int{}
+	labels := []string{}
+	for label := range net.Places {
+		labels = append(labels, label)
+	}
+	for label := range net.Transitions {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		var pos *metamodel.Position
+		root := false
+		if p := net.Places[label]; p != nil {
+			pos = &p.Position
+			root = p.Initial > 0
+		} else {
+			pos = &net.Transitions[label].Position
+		}
+		index[label] = len(g.elements)
+		g.elements = append(g.elements, &element{
+			label: label,
+			pos:   pos,
+			fixed: l.KeepFixed && (pos.X != 0 || pos.Y != 0),
+			root:  root,
+			x:     float64(pos.X),
+			y:     float64(pos.Y),
+		})
+	}
+	for _, a := range net.Arcs {
+		if a.Inhibitor {
+			continue
+		}
+		g.edges = append(g.edges, [2]int{index[metamodel.LabelOf(a.Source)], index[metamodel.LabelOf(a.Target)]})
+	}
+	return g
+}
+
+// apply copies computed coordinates into the model leaving fixed elements untouched
+func (g *graph) apply() {
+	for _, e := range g.elements {
+		if !e.fixed {
+			e.pos.X = int64(math.Round(e.x))
+			e.pos.Y = int64(math.Round(e.y))
+		}
+	}
+}
+
+// roots returns elements without incoming flow arcs followed by initially marked places
+func (g *graph) roots() []int {
+	incoming := make([]int, len(g.elements))
+	for _, e := range g.edges {
+		incoming[e[1]]++
+	}
+	roots := []int{}
+	for v, n := range incoming {
+		if n == 0 {
+			roots = append(roots, v)
+		}
+	}
+	for v, e := range g.elements {
+		if incoming[v] > 0 && e.root {
+			roots = append(roots, v)
+		}
+	}
+	return roots
+}
+
+// Auto uses a layered layout for workflow shaped nets which have a source or an initially marked place
+// and falls back to force-directed placement otherwise
+func Auto(m metamodel.MetaModel, opts ...func(*Layout)) {
+	l := newLayout(opts)
+	g := newGraph(m.Net(), l)
+	if len(g.roots()) > 0 {
+		g.layered(l)
+	} else {
+		g.forceDirected(l)
+	}
+	g.apply()
+}
+
+// Layered assigns positions in left to right layers following the direction of arcs
+func Layered(m metamodel.MetaModel, opts ...func(*Layout)) {
+	l := newLayout(opts)
+	g := newGraph(m.Net(), l)
+	g.layered(l)
+	g.apply()
+}
+
+// ForceDirected assigns positions by simulating attraction along arcs and repulsion between elements
+func ForceDirected(m metamodel.MetaModel, opts ...func(*Layout)) {
+	l := newLayout(opts)
+	g := newGraph(m.Net(), l)
+	g.forceDirected(l)
+	g.apply()
+}
+
+// acyclic returns edges with back edges reversed using a depth first search from roots
+func (g *graph) acyclic() [][2]int {
+	n := len(g.elements)
+	out := make([][]int, n)
+	for _, e := range g.edges {
+		out[e[0]] = append(out[e[0]], e[1])
+	}
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make([]int, n)
+	back := map[[2]int]bool{}
+	var visit func(v int)
+	visit = func(v int) {
+		state[v] = active
+		for _, w := range out[v] {
+			if state[w] == active {
+				back[[2]int{v, w}] = true
+			} else if state[w] == unvisited {
+				visit(w)
+			}
+		}
+		state[v] = done
+	}
+	for _, v := range g.roots() {
+		if state[v] == unvisited {
+			visit(v)
+		}
+	}
+	for v := 0; v < n; v++ {
+		if state[v] == unvisited {
+			visit(v)
+		}
+	}
+	edges := [][2]int{}
+	for _, e := range g.edges {
+		if e[0] == e[1] {
+			continue
+		}
+		if back[e] {
+			e = [2]int{e[1], e[0]}
+		}
+		edges = append(edges, e)
+	}
+	return edges
+}
+
+func (g *graph) layered(l Layout) {
+	n := len(g.elements)
+	edges := g.acyclic()
+
+	// longest path layering
+	layer := make([]int, n)
+	for changed := true; changed; {
+		changed = false
+		for _, e := range edges {
+			if layer[e[1]] < layer[e[0]]+1 {
+				layer[e[1]] = layer[e[0]] + 1
+				changed = true
+			}
+		}
+	}
+	depth := 0
+	for _, v := range layer {
+		if v+1 > depth {
+			depth = v + 1
+		}
+	}
+	layers := make([][]int, depth)
+	for v := 0; v < n; v++ {
+		layers[layer[v]] = append(layers[layer[v]], v)
+	}
+
+	// barycenter ordering sweeping forward and backward
+	order := make([]float64, n)
+	for _, vs := range layers {
+		for i, v := range vs {
+			order[v] = float64(i)
+		}
+	}
+	neighbours := make([][]int, n)
+	for _, e := range edges {
+		neighbours[e[0]] = append(neighbours[e[0]], e[1])
+		neighbours[e[1]] = append(neighbours[e[1]], e[0])
+	}
+	for it := 0; it < l.Iterations; it++ {
+		forward := it%2 == 0
+		for k := range layers {
+			li := k
+			if !forward {
+				li = depth - 1 - k
+			}
+			bary := map[int]float64{}
+			for _, v := range layers[li] {
+				sum, count := 0.0, 0
+				for _, w := range neighbours[v] {
+					if (forward && layer[w] == li-1) || (!forward && layer[w] == li+1) {
+						sum += order[w]
+						count++
+					}
+				}
+				if count > 0 {
+					bary[v] = sum / float64(count)
+				} else {
+					bary[v] = order[v]
+				}
+			}
+			sort.SliceStable(layers[li], func(i, j int) bool {
+				return bary[layers[li][i]] < bary[layers[li][j]]
+			})
+			for i, v := range layers[li] {
+				order[v] = float64(i)
+			}
+		}
+	}
+
+	// grid cells taken by fixed elements are skipped so nothing is placed on top of them
+	spacing := float64(l.Spacing)
+	occupied := func(x, y float64) bool {
+		for _, e := range g.elements {
+			if e.fixed && math.Abs(e.x-x) < spacing/2 && math.Abs(e.y-y) < spacing/2 {
+				return true
+			}
+		}
+		return false
+	}
+	for li, vs := range layers {
+		x, row := spacing*float64(li+1), 1
+		for _, v := range vs {
+			e := g.elements[v]
+			if e.fixed {
+				continue
+			}
+			for occupied(x, spacing*float64(row)) {
+				row++
+			}
+			e.x, e.y = x, spacing*float64(row)
+			row++
+		}
+	}
+}
+
+// forceDirected runs a Fruchterman-Reingold simulation starting from a circle in label order
+func (g *graph) forceDirected(l Layout) {
+	n := len(g.elements)
+	if n == 0 {
+		return
+	}
+	k := float64(l.Spacing)
+	radius := k * float64(n) / (2 * math.Pi)
+	for i, e := range g.elements {
+		if !e.fixed {
+			angle := 2 * math.Pi * float64(i) / float64(n)
+			e.x = radius * math.Cos(angle)
+			e.y = radius * math.Sin(angle)
+		}
+	}
+	temperature := radius / 2
+	iterations := l.Iterations * 10
+	for it := 0; it < iterations; it++ {
+		dx := make([]float64, n)
+		dy := make([]float64, n)
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				x := g.elements[i].x - g.elements[j].x
+				y := g.elements[i].y - g.elements[j].y
+				d := math.Max(math.Hypot(x, y), 0.01)
+				f := k * k / d
+				dx[i] += x / d * f
+				dy[i] += y / d * f
+				dx[j] -= x / d * f
+				dy[j] -= y / d * f
+			}
+		}
+		for _, e := range g.edges {
+			a, b := g.elements[e[0]], g.elements[e[1]]
+			x, y := a.x-b.x, a.y-b.y
+			d := math.Max(math.Hypot(x, y), 0.01)
+			f := d * d / k
+			dx[e[0]] -= x / d * f
+			dy[e[0]] -= y / d * f
+			dx[e[1]] += x / d * f
+			dy[e[1]] += y / d * f
+		}
+		for i, e := range g.elements {
+			if e.fixed {
+				continue
+			}
+			d := math.Max(math.Hypot(dx[i], dy[i]), 0.01)
+			step := math.Min(d, temperature)
+			e.x += dx[i] / d * step
+			e.y += dy[i] / d * step
+		}
+		temperature *= 1 - 1/float64(iterations)
+	}
+
+	// shift the drawing to start one spacing from the origin unless it is anchored by fixed elements
+	minX, minY := math.Inf(1), math.Inf(1)
+	for _, e := range g.elements {
+		if e.fixed {
+			return
+		}
+		minX = math.Min(minX, e.x)
+		minY = math.Min(minY, e.y)
+	}
+	for _, e := range g.elements {
+		e.x += k - minX
+		e.y += k - minY
+	}
+}
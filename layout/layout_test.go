@@ -0,0 +1,83 @@
+package layout_test
+
+import (
+	"github.com/pflow-xyz/go-metamodel/layout"
+	"github.com/pflow-xyz/go-metamodel/metamodel"
+	"testing"
+)
+
+func workflow(m metamodel.Declaration) {
+	cell, fn := m.Cell, m.Fn
+	start := cell().Label("start").Initial(1)
+	pending := cell().Label("pending")
+	done := cell().Label("done")
+	submit := fn().Label("submit")
+	approve := fn().Label("approve")
+	reject := fn().Label("reject")
+	start.Tx(1, submit)
+	submit.Tx(1, pending)
+	pending.Tx(1, approve)
+	approve.Tx(1, done)
+	pending.Tx(1, reject)
+	reject.Tx(1, start)
+}
+
+func assertDistinct(t *testing.T, net *metamodel.PetriNet) {
+	seen := map[metamodel.Position]string{}
+	check := func(label string, p metamodel.Position) {
+		if p.X <= 0 || p.Y <= 0 {
+			t.Fatalf("expected %s to be positioned got %v", label, p)
+		}
+		if other, ok := seen[p]; ok {
+			t.Fatalf("%s overlaps %s at %v", label, other, p)
+		}
+		seen[p] = label
+	}
+	for label, p := range net.Places {
+		check(label, p.Position)
+	}
+	for label, tx := range net.Transitions {
+		check(label, tx.Position)
+	}
+}
+
+func TestLayered(t *testing.T) {
+	mm := metamodel.New().Define(workflow)
+	layout.Auto(mm)
+	net := mm.Net()
+	assertDistinct(t, net)
+	if !(net.Places["start"].X < net.Transitions["submit"].X && net.Transitions["submit"].X < net.Places["pending"].X) {
+		t.Fatalf("expected left to right flow")
+	}
+	if net.Transitions["approve"].X != net.Transitions["reject"].X {
+		t.Fatalf("expected approve and reject in the same layer")
+	}
+}
+
+func TestLayeredKeepFixed(t *testing.T) {
+	mm := metamodel.New().Define(workflow)
+	mm.Node("done").Position(240, 80) // the cell pending gets without fixed elements
+	mm.Node("reject").Position(320, 160)
+	layout.Auto(mm, layout.KeepFixed)
+	net := mm.Net()
+	assertDistinct(t, net)
+	if net.Places["done"].X != 240 || net.Places["done"].Y != 80 || net.Transitions["reject"].Y != 160 {
+		t.Fatalf("expected fixed positions to be kept")
+	}
+
+	mm = metamodel.New().Define(workflow)
+	mm.Node("start").Position(80, 80)
+	layout.Layered(mm, layout.KeepFixed)
+	assertDistinct(t, mm.Net())
+}
+
+func TestForceDirected(t *testing.T) {
+	mm := metamodel.New().Define(workflow)
+	mm.Node("start").Position(500, 500)
+	layout.ForceDirected(mm, layout.KeepFixed)
+	net := mm.Net()
+	assertDistinct(t, net)
+	if net.Places["start"].X != 500 || net.Places["start"].Y != 500 {
+		t.Fatalf("expected fixed position to be kept")
+	}
+}
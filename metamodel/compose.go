@@ -0,0 +1,217 @@
+package metamodel
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Component is a model taking part in a composition
+type Component struct {
+	Namespace string            // prefix for labels that are not fused, "billing" turns "invoice" into "billing.invoice"
+	Model     MetaModel         // model contributing its elements
+	Fuse      map[string]string // place or transition label -> shared label it is fused into
+}
+
+// Fusion configures which elements Compose fuses besides the explicit mappings of each component
+type Fusion struct {
+	ByLabel     bool // places with the same label in more than one component are fused
+	Transitions bool // transitions with the same label are fused too and fire together
+}
+
+// ByLabel fuses places sharing a label
+func ByLabel(f *Fusion) {
+	f.ByLabel = true
+}
+
+// FuseTransitions fuses places and transitions sharing a label
+func FuseTransitions(f *Fusion) {
+	f.ByLabel = true
+	f.Transitions = true
+}
+
+type arcKey struct {
+	source, target string
+	inhibit        bool
+}
+
+// Compose merges components into one model, fused elements keep their shared label and everything else is namespaced
+// fused places must agree on initial tokens, capacity and colour set, fused transitions on their role, rate, delay and subnet,
+// and shared arcs on their weight, unset values defer to the other component
+// offsets and deltas are recomputed as with Normalize
+func Compose(components []Component, opts ...func(*Fusion)) (MetaModel, error) {
+	f := Fusion{}
+	for _, opt := range opts {
+		opt(&f)
+	}
+	decls := make([]DeclarationObject, len(components))
+	places, transitions := map[string]int{}, map[string]int{}
+	for i, c := range components {
+		decls[i] = c.Model.ToDeclarationObject()
+		for label := range decls[i].Places {
+			places[label]++
+		}
+		for label := range decls[i].Transitions {
+			transitions[label]++
+		}
+	}
+	modelType := PetriNetType
+	if len(decls) > 0 {
+		modelType = decls[0].ModelType
+	}
+	m := New(modelType).(*Model)
+	err := m.collect(func() bool {
+		obj := DeclarationObject{
+			ModelType:   modelType,
+			Version:     DeclarationVersion,
+			Places:      PlaceMapDefinition{},
+			Transitions: TransitionMapDefinition{},
+			Arcs:        ArcListDefinition{},
+		}
+		fused := map[string]bool{}
+		weights := map[arcKey]int64{}
+		for i, c := range components {
+			d := decls[i]
+			if d.ModelType != modelType {
+				m.fail(FusionConflict, "modelType", d.ModelType)
+				continue
+			}
+			name := func(label string, byLabel bool) (string, bool) {
+				if shared, ok := c.Fuse[label]; ok {
+					return shared, true
+				}
+				if byLabel {
+					return label, true
+				}
+				if c.Namespace == "" {
+					return label, false
+				}
+				return c.Namespace + "." + label, false
+			}
+			names := map[string]string{}
+			for _, label := range SortedKeys(d.Places) {
+				p := d.Places[label]
+				n, isFused := name(label, f.ByLabel && places[label] > 1)
+				names[label] = n
+				if prior, ok := obj.Places[n]; ok {
+					if !isFused || !fused[n] {
+						m.fail(DuplicateLabel, n)
+					} else if merged, field := fusePlace(prior, p); field != "" {
+						m.fail(FusionConflict, n, field)
+					} else {
+						obj.Places[n] = merged
+					}
+					continue
+				}
+				fused[n] = isFused
+				obj.Places[n] = p
+			}
+			for _, label := range SortedKeys(d.Transitions) {
+				t := d.Transitions[label]
+				n, isFused := name(label, f.Transitions && transitions[label] > 1)
+				names[label] = n
+				if t.Subnet != nil {
+					// ports are bound to places of this component which may have been renamed
+					sub := *t.Subnet
+					sub.Ports = map[string]string{}
+					for _, port := range SortedKeys(t.Subnet.Ports) {
+						socket := t.Subnet.Ports[port]
+						if _, ok := names[socket]; !ok {
+							m.fail(UnknownElement, n, port, socket)
+							continue
+						}
+						sub.Ports[port] = names[socket]
+					}
+					t.Subnet = &sub
+				}
+				if prior, ok := obj.Transitions[n]; ok {
+					if !isFused || !fused[n] {
+						m.fail(DuplicateLabel, n)
+					} else if merged, field := fuseTransition(prior, t); field != "" {
+						m.fail(FusionConflict, n, field)
+					} else {
+						obj.Transitions[n] = merged
+					}
+					continue
+				}
+				fused[n] = isFused
+				obj.Transitions[n] = t
+			}
+			for _, a := range d.Arcs {
+				a.Source, a.Target = names[a.Source], names[a.Target]
+				key := arcKey{a.Source, a.Target, a.Inhibit}
+				if w, ok := weights[key]; ok {
+					// fused elements share the arc, Index would keep only one of them
+					if w != a.Weight {
+						m.fail(FusionConflict, a.Source, a.Target)
+					}
+					continue
+				}
+				weights[key] = a.Weight
+				obj.Arcs = append(obj.Arcs, a)
+			}
+		}
+		for i, label := range SortedKeys(obj.Places) {
+			p := obj.Places[label]
+			p.Offset = int64(i)
+			obj.Places[label] = p
+		}
+		if len(m.errors) > 0 {
+			return false
+		}
+		data, _ := json.Marshal(obj)
+		return m.loadJsonDefinition(string(data))
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.Normalize()
+	return m, nil
+}
+
+// fusePlace merges two definitions of a shared place returning the conflicting field if they disagree
+func fusePlace(a PlaceDefinition, b PlaceDefinition) (PlaceDefinition, string) {
+	// zero means unset and defers to the other definition
+	if a.Initial == 0 {
+		a.Initial = b.Initial
+	} else if b.Initial != 0 && b.Initial != a.Initial {
+		return a, "initial"
+	}
+	if a.Capacity == 0 {
+		a.Capacity = b.Capacity
+	} else if b.Capacity != 0 && b.Capacity != a.Capacity {
+		return a, "capacity"
+	}
+	if a.ColourSet != b.ColourSet {
+		return a, "colourSet"
+	}
+	return a, ""
+}
+
+// fuseTransition merges two definitions of a shared transition returning the conflicting field if they disagree
+func fuseTransition(a TransitionDefinition, b TransitionDefinition) (TransitionDefinition, string) {
+	if a.Role != b.Role {
+		return a, "role"
+	}
+	if a.Rate == 0 {
+		a.Rate = b.Rate
+	} else if b.Rate != 0 && b.Rate != a.Rate {
+		return a, "rate"
+	}
+	if a.Earliest == 0 {
+		a.Earliest = b.Earliest
+	} else if b.Earliest != 0 && b.Earliest != a.Earliest {
+		return a, "earliest"
+	}
+	if a.Latest == 0 {
+		a.Latest = b.Latest
+	} else if b.Latest != 0 && b.Latest != a.Latest {
+		return a, "latest"
+	}
+	if a.Subnet == nil {
+		a.Subnet = b.Subnet
+	} else if b.Subnet != nil && !reflect.DeepEqual(a.Subnet, b.Subnet) {
+		return a, "subnet"
+	}
+	a.AllowReentry = a.AllowReentry || b.AllowReentry
+	return a, ""
+}
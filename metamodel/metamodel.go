@@ -3,7 +3,10 @@ package metamodel
 import (
 	"encoding/json"
 	"fmt"
+	canonicaljson "github.com/gibson042/canonicaljson-go"
 	"github.com/pflow-xyz/go-metamodel/compression"
+	"math"
+	"sort"
 )
 
 // Position defines location of a Place or Transition element
@@ -47,11 +50,12 @@ func VectorFromBytes(bv []byte) (v Vector) {
 
 // Place elements contain tokens
 type Place struct {
-	Label    string `json:"label"`
-	Offset   int64  `json:"offset"`
-	Position `json:"position"`
-	Initial  int64 `json:"initial"`
-	Capacity int64 `json:"capacity"`
+	Label     string `json:"label"`
+	Offset    int64  `json:"offset"`
+	Position  `json:"position"`
+	Initial   int64  `json:"initial"`
+	Capacity  int64  `json:"capacity"`
+	ColourSet string `json:"colourSet,omitempty"` // coloured places hold records of this set, empty for plain tokens
 }
 
 type PlaceMap = map[string]*Place
@@ -65,9 +69,11 @@ type Guard struct {
 
 type GuardMap = map[string]*Guard
 
+// SubnetNode embeds a net into a substitution transition
 type SubnetNode struct {
 	*PetriNet  `json:"-"`
-	SubnetType string `json:"subnetType"`
+	SubnetType string            `json:"subnetType"`
+	Ports      map[string]string `json:"ports"` // subnet place label -> enclosing place label
 }
 
 // Transition defines a token transfer action
@@ -77,10 +83,18 @@ type Transition struct {
 	Role         Role     `json:"role"`
 	Delta        Vector   `json:"delta"`
 	Guards       GuardMap `json:"guards"`
-	AllowReentry bool     `json:"allowReentry"`
+	AllowReentry bool     `json:"allowReentry"`       // in safe nets a marked output place absorbs the token, fires report Reentered
+	Rate         float64  `json:"rate,omitempty"`     // exponential firing rate used by simulation, 0 is unset and means the default 1
+	Earliest     int64    `json:"earliest,omitempty"` // clock ticks a transition must stay enabled before it can fire
+	Latest       int64    `json:"latest,omitempty"`   // clock ticks after which an enabled transition is overdue, 0 = never
 	*SubnetNode  `json:"subNet"`
 }
 
+// IsSubstitution is true for transitions embedding a subnet, they only fire in the flattened net
+func (t *Transition) IsSubstitution() bool {
+	return t.SubnetNode != nil && t.SubnetNode.PetriNet != nil
+}
+
 type TransitionMap = map[string]*Transition
 
 // Node is an interstitial interface used when composing model elements
@@ -96,6 +110,11 @@ type Node interface {
 	Initial(int64) Node
 	Capacity(int64) Node
 	Role(string) Node
+	Rate(float64) Node
+	Delay(earliest int64, latest int64) Node
+	Colour(set string) Node
+	Bind(variable string, target Node) Node
+	Subnet(subnetType string, net *PetriNet, ports map[string]string) Node
 }
 
 // Add vectors while asserting underflow & capacity checks
@@ -140,7 +159,7 @@ func (n *node) Initial(i int64) Node {
 	if n.IsPlace() {
 		n.Place.Initial = i
 	} else {
-		panic(ExpectedPlace)
+		n.m.fail(ExpectedPlace, n.Transition.Label)
 	}
 	return n
 }
@@ -150,21 +169,15 @@ func (n *node) Capacity(i int64) Node {
 	if n.IsPlace() {
 		n.Place.Capacity = i
 	} else {
-		panic(ExpectedPlace)
+		n.m.fail(ExpectedPlace, n.Transition.Label)
 	}
 	return n
 }
 
 // Tx defines a path between elements
 func (n *node) Tx(weight int64, target Node) Node {
-	if n.IsPlace() && target.IsPlace() {
-		panic(BadArcPlace)
-	}
-	if n.IsTransition() && target.IsTransition() {
-		panic(BadArcTransition)
-	}
-	if weight < 0 {
-		panic(BadWeight)
+	if !n.m.checkArc(n, target, weight) {
+		return n
 	}
 	n.m.Arcs = append(n.m.Arcs, Arc{
 		Source:    n,
@@ -175,22 +188,43 @@ func (n *node) Tx(weight int64, target Node) Node {
 	return n
 }
 
+// Bind defines a single token path whose coloured token is bound to a variable
+func (n *node) Bind(variable string, target Node) Node {
+	if !n.m.checkArc(n, target, 1) {
+		return n
+	}
+	n.m.Arcs = append(n.m.Arcs, Arc{
+		Source: n,
+		Target: target,
+		Weight: 1,
+		Bind:   variable,
+	})
+	return n
+}
+
 // Guard defines an inhibitor rule
 func (n *node) Guard(weight int64, target Node) Node {
+	if target == nil {
+		n.m.fail(UnknownElement, LabelOf(n))
+		return n
+	}
 	var isReadArc = false
 	if n.IsTransition() {
 		if !target.IsPlace() {
-			panic(BadInhibitorTarget)
+			n.m.fail(BadInhibitorTarget, LabelOf(n), LabelOf(target))
+			return n
 		}
 		isReadArc = true
 	}
 	if target.IsPlace() {
 		if !n.IsTransition() {
-			panic(BadInhibitorTarget)
+			n.m.fail(BadInhibitorTarget, LabelOf(n), LabelOf(target))
+			return n
 		}
 	}
 	if weight < 0 {
-		panic(BadWeight)
+		n.m.fail(BadWeight, LabelOf(n), LabelOf(target))
+		return n
 	}
 	n.m.Arcs = append(n.m.Arcs, Arc{
 		Source:    n,
@@ -233,12 +267,21 @@ func (n *node) Position(x int64, y int64, z ...int64) Node {
 }
 
 // Label sets the name of an element
+// reusing a label is reported by DefineE while Define keeps replacing the element
 func (n *node) Label(label string) Node {
 	if n.IsPlace() {
+		if p := n.m.Places[label]; p != nil && p != n.Place && n.m.collecting {
+			n.m.fail(DuplicateLabel, label)
+			return n
+		}
 		n.m.Places[label] = n.Place
 		delete(n.m.Places, n.Place.Label)
 		n.Place.Label = label
 	} else if n.IsTransition() {
+		if t := n.m.Transitions[label]; t != nil && t != n.Transition && n.m.collecting {
+			n.m.fail(DuplicateLabel, label)
+			return n
+		}
 		n.m.Transitions[label] = n.Transition
 		delete(n.m.Transitions, n.Transition.Label)
 		n.Transition.Label = label
@@ -253,7 +296,47 @@ func (n *node) Role(label string) Node {
 		n.m.Roles[label] = r
 		n.Transition.Role = r
 	} else {
-		panic(ExpectedTransition)
+		n.m.fail(ExpectedTransition, n.Place.Label)
+	}
+	return n
+}
+
+// Rate sets the exponential firing rate of a transition
+// 0 is the unset value and simulates at the default rate 1, a reaction that must not fire needs a guard instead
+func (n *node) Rate(r float64) Node {
+	if !n.IsTransition() {
+		n.m.fail(ExpectedTransition, n.Place.Label)
+	} else if !validRate(r) {
+		n.m.fail(BadRate, n.Transition.Label)
+	} else {
+		n.Transition.Rate = r
+	}
+	return n
+}
+
+func validRate(r float64) bool {
+	return r >= 0 && !math.IsInf(r, 1)
+}
+
+// Delay sets the firing interval of a timed transition, a latest of 0 leaves it without a deadline
+func (n *node) Delay(earliest int64, latest int64) Node {
+	if !n.IsTransition() {
+		n.m.fail(ExpectedTransition, n.Place.Label)
+	} else if earliest < 0 || latest < 0 || (latest > 0 && latest < earliest) {
+		n.m.fail(BadDelay, n.Transition.Label)
+	} else {
+		n.Transition.Earliest = earliest
+		n.Transition.Latest = latest
+	}
+	return n
+}
+
+// Colour sets the colour set of the records held by a place
+func (n *node) Colour(set string) Node {
+	if n.IsPlace() {
+		n.Place.ColourSet = set
+	} else {
+		n.m.fail(ExpectedPlace, n.Transition.Label)
 	}
 	return n
 }
@@ -264,6 +347,7 @@ type Arc struct {
 	Weight    int64
 	Inhibitor bool
 	Read      bool
+	Bind      string // variable naming the coloured token carried by a flow arc
 }
 
 type PetriNet struct {
@@ -296,6 +380,13 @@ func (n *PetriNet) CapacityVector() (v Vector) {
 	return v
 }
 
+// ModelType values select execution semantics
+const (
+	PetriNetType   = "petriNet"   // places hold any number of tokens up to capacity
+	WorkflowType   = "workflow"   // places hold at most one token
+	ElementaryType = "elementary" // at most one token in the whole net
+)
+
 const (
 	BadInhibitorSource  = "inhibitor source must be a place"
 	BadInhibitorTarget  = "inhibitor target must be a transition"
@@ -310,39 +401,92 @@ const (
 	ExpectedTransition  = "element was expected to be a transition"
 	ExpectedPlace       = "element was expected to be a place"
 	InhibitedTransition = "transition is inhibited by place %s"
+	Inhibited           = "transition is inhibited"
 	UnexpectedArguments = "expected %v arguments got %v"
+	BadSequence         = "sequence %v is out of range"
+	ReplayMismatch      = "replayed state does not match event %v"
+	StaleSequence       = "expected sequence %v but process is at %v"
+	Unsupported         = "process does not support %s"
+	ReentryDenied       = "output place is already marked"
+	Reentered           = "output place was already marked, tokens merged"
+	UnknownElement      = "element does not exist"
+	BadBinding          = "bound arcs must carry a single token"
+	NoBinding           = "no binding of %s satisfies its guard"
+	BadToken            = "token does not match colour set %s"
+	BadExpression       = "expression for %s produced %v tokens expected %v"
+	UnknownColourSet    = "colour set %s is not defined"
+	FusionConflict      = "fused elements disagree"
+	DuplicateLabel      = "label is already in use"
+	BadOffset           = "place offset is out of range or reused"
+	BadInitial          = "initial tokens must be between zero and capacity"
+	BadCapacity         = "capacity must be positive integer or zero"
+	BadDelta            = "delta length does not match place count"
+	BadRate             = "rate must be a finite non-negative number"
+	BadDelay            = "delay interval must be non-negative with latest after earliest"
+	TooEarly            = "transition %s cannot fire before %v"
+	Overdue             = "transition %s must fire by %v"
+	BadSchedule         = "cannot schedule at %v, clock is at %v"
+	BadDeclaration      = "declaration could not be parsed"
 	OK                  = "OK"
 )
 
+// Principal identifies who fires an op and the roles they hold
+type Principal struct {
+	Id    string
+	Roles []string
+}
+
 type Op struct {
-	Action   string
-	Multiple int64
-	Role     string
+	Action    string
+	Multiple  int64
+	Role      string
+	Principal *Principal
 }
 
 type Event struct {
 	Seq   int64
 	State Vector
 	Op
+	Step int64 // non-zero for ops fired together in one step, shared by every op of the step
 }
 
+// DeclarationVersion is the schema written by ToDeclarationObject
+// v1 adds z positions, reentry, rates, delays, colour sets, bindings, read arcs, path and cid to the v0 schema
+const DeclarationVersion = "v1"
+
 type PlaceDefinition struct {
-	Offset   int64 `json:"offset"`
-	Initial  int64 `json:"initial"`
-	Capacity int64 `json:"capacity"`
-	X        int64 `json:"x"`
-	Y        int64 `json:"y"`
+	Offset    int64  `json:"offset"`
+	Initial   int64  `json:"initial"`
+	Capacity  int64  `json:"capacity"`
+	X         int64  `json:"x"`
+	Y         int64  `json:"y"`
+	Z         int64  `json:"z,omitempty"`
+	ColourSet string `json:"colourSet,omitempty"`
 }
 type TransitionDefinition struct {
-	Role string `json:"role"`
-	X    int64  `json:"x"`
-	Y    int64  `json:"y"`
+	Role         string            `json:"role"`
+	X            int64             `json:"x"`
+	Y            int64             `json:"y"`
+	Z            int64             `json:"z,omitempty"`
+	AllowReentry bool              `json:"allowReentry,omitempty"`
+	Rate         float64           `json:"rate,omitempty"`
+	Earliest     int64             `json:"earliest,omitempty"`
+	Latest       int64             `json:"latest,omitempty"`
+	Subnet       *SubnetDefinition `json:"subnet,omitempty"`
+}
+
+type SubnetDefinition struct {
+	Type  string            `json:"type"`
+	Ports map[string]string `json:"ports"`
+	Net   DeclarationObject `json:"net"`
 }
 type ArcDefinition struct {
 	Source  string `json:"source"`
 	Target  string `json:"target"`
 	Weight  int64  `json:"weight"`
 	Inhibit bool   `json:"inhibit"`
+	Read    bool   `json:"read,omitempty"`
+	Bind    string `json:"bind,omitempty"`
 }
 
 type PlaceMapDefinition map[string]PlaceDefinition
@@ -355,6 +499,8 @@ type DeclarationObject struct {
 	Places      PlaceMapDefinition      `json:"places"`
 	Transitions TransitionMapDefinition `json:"transitions"`
 	Arcs        ArcListDefinition       `json:"arcs"`
+	Path        string                  `json:"path,omitempty"`
+	Cid         string                  `json:"cid,omitempty"`
 }
 
 type Process interface {
@@ -365,6 +511,35 @@ type Process interface {
 	Fire(Op) (ok bool, msg string, out Vector)
 }
 
+// Result records the outcome of one op in a batch
+type Result struct {
+	Op
+	Ok    bool   `json:"ok"`
+	Msg   string `json:"msg"`
+	State Vector `json:"state"`
+}
+
+// Enablement explains if a transition can fire and the largest multiple that passes capacity and underflow checks
+// Multiple is Unbounded when no place limits the transition, it is not a valid Op.Multiple
+// Label names the place, guard or role that blocks a disabled transition
+type Enablement struct {
+	Action   string `json:"action"`
+	Enabled  bool   `json:"enabled"`
+	Multiple int64  `json:"multiple"`
+	Reason   string `json:"reason"`
+	Label    string `json:"label"`
+}
+
+// Unbounded is the Enablement.Multiple of a transition that no place limits
+const Unbounded int64 = -1
+
+// History is a process that keeps an event log of every successful fire
+type History interface {
+	Process
+	Events() []Event
+	Undo(seq int64) (ok bool, msg string, out Vector)
+}
+
 type Declaration interface {
 	Cell(...func(p *Place)) Node
 	Fn(...func(t *Transition)) Node
@@ -375,22 +550,30 @@ type Editor interface {
 	TransitionSeq() Label
 	Index() Editor
 	Graph() Editor
+	Normalize() Editor
 }
 
 type MetaModel interface {
 	Net() *PetriNet
 	Define(...func(Declaration)) MetaModel
 	Edit() Editor
+	DefineE(...func(Declaration)) (MetaModel, error)
+	Validate() []ValidationError
 	Node(oid string) Node
+	NodeE(oid string) (Node, error)
 	UnpackFromUrl(url string) (obj string, ok bool)
+	UnpackFromUrlE(url string) (obj string, err error)
 	ZipUrl(...string) (url string, ok bool)
 	GetViewPort() (int, int, int, int)
 	ToDeclaration() (obj []byte, ok bool)
 	ToDeclarationObject() DeclarationObject
+	Flatten() MetaModel
 }
 
 type Model struct {
 	*PetriNet
+	collecting bool
+	errors     []ValidationError
 }
 
 func (m *Model) GetViewPort() (x1 int, y1 int, width int, height int) {
@@ -437,35 +620,63 @@ func (m *Model) GetViewPort() (x1 int, y1 int, width int, height int) {
 }
 func (m *Model) ToDeclaration() ([]byte, bool) {
 	modelObj := m.ToDeclarationObject()
-	data, err := json.Marshal(modelObj) // TODO write a custom encoder to match front end style
+	data, err := canonicaljson.Marshal(modelObj) // TODO write a custom encoder to match front end style
 	return data, err == nil
 }
 
 func (m *Model) ToDeclarationObject() DeclarationObject {
 	modelObject := DeclarationObject{
 		ModelType:   m.ModelType,
-		Version:     "v0",
+		Version:     DeclarationVersion,
 		Places:      PlaceMapDefinition{},
 		Transitions: TransitionMapDefinition{},
 		Arcs:        ArcListDefinition{},
+		Path:        m.Path,
+		Cid:         m.Cid,
+	}
+	// offsets and arcs follow Normalize so equivalent nets serialize identically
+	offsets := map[string]int64{}
+	for i, label := range SortedKeys(m.Places) {
+		offsets[label] = int64(i)
 	}
 	for label, p := range m.Places {
 		modelObject.Places[label] = PlaceDefinition{
-			Offset:   p.Offset,
-			Initial:  p.Initial,
-			Capacity: p.Capacity,
-			X:        p.X,
-			Y:        p.Y,
+			Offset:    offsets[label],
+			Initial:   p.Initial,
+			Capacity:  p.Capacity,
+			X:         p.X,
+			Y:         p.Y,
+			Z:         p.Z,
+			ColourSet: p.ColourSet,
 		}
 	}
 	for label, t := range m.Transitions {
 		modelObject.Transitions[label] = TransitionDefinition{
-			Role: t.Role.Label,
-			X:    t.X,
-			Y:    t.Y,
+			Role:         t.Role.Label,
+			X:            t.X,
+			Y:            t.Y,
+			Z:            t.Z,
+			AllowReentry: t.AllowReentry,
+			Rate:         t.Rate,
+			Earliest:     t.Earliest,
+			Latest:       t.Latest,
+		}
+		if t.IsSubstitution() {
+			sub := &Model{PetriNet: t.SubnetNode.PetriNet}
+			definition := modelObject.Transitions[label]
+			definition.Subnet = &SubnetDefinition{
+				Type:  t.SubnetType,
+				Ports: t.Ports,
+				Net:   sub.ToDeclarationObject(),
+			}
+			modelObject.Transitions[label] = definition
 		}
 	}
-	for _, a := range m.Arcs {
+	arcs := append([]Arc{}, m.Arcs...)
+	sort.SliceStable(arcs, func(i, j int) bool {
+		return arcLess(arcs[i], arcs[j])
+	})
+	for _, a := range arcs {
 		if a.Weight == 0 {
 			a.Weight = 1
 		}
@@ -475,6 +686,8 @@ func (m *Model) ToDeclarationObject() DeclarationObject {
 				Target:  a.Target.GetPlace().Label,
 				Weight:  a.Weight,
 				Inhibit: a.Inhibitor,
+				Read:    a.Read,
+				Bind:    a.Bind,
 			})
 		} else {
 			modelObject.Arcs = append(modelObject.Arcs, ArcDefinition{
@@ -482,6 +695,8 @@ func (m *Model) ToDeclarationObject() DeclarationObject {
 				Target:  a.Target.GetTransition().Label,
 				Weight:  a.Weight,
 				Inhibit: a.Inhibitor,
+				Read:    a.Read,
+				Bind:    a.Bind,
 			})
 
 		}
@@ -497,20 +712,34 @@ func (m *Model) loadJsonDefinition(obj string) (ok bool) {
 	modelObject := DeclarationObject{}
 	err := json.Unmarshal([]byte(obj), &modelObject)
 	if err != nil {
-		panic(err)
+		if !m.collecting {
+			panic(err)
+		}
+		m.errors = append(m.errors, ValidationError{Reason: BadDeclaration, Err: err})
+		return false
+	}
+	switch modelObject.Version {
+	case "", "v0", DeclarationVersion:
+	default:
+		m.fail(BadDeclaration, modelObject.Version)
+		return false
 	}
 	m.ModelType = modelObject.ModelType
+	m.Path = modelObject.Path
+	m.Cid = modelObject.Cid
 	m.Places = PlaceMap{}
 	m.Transitions = TransitionMap{}
 	m.Arcs = []Arc{}
+	m.Roles = RoleMap{defaultRole.Label: defaultRole}
 
 	for label, p := range modelObject.Places {
 		place := &Place{
-			Label:    label,
-			Offset:   p.Offset,
-			Position: Position{X: p.X, Y: p.Y},
-			Initial:  p.Initial,
-			Capacity: p.Capacity,
+			Label:     label,
+			Offset:    p.Offset,
+			Position:  Position{X: p.X, Y: p.Y, Z: p.Z},
+			Initial:   p.Initial,
+			Capacity:  p.Capacity,
+			ColourSet: p.ColourSet,
 		}
 		m.Places[label] = place
 	}
@@ -520,39 +749,65 @@ func (m *Model) loadJsonDefinition(obj string) (ok bool) {
 		if t.Role != "" {
 			role = t.Role
 		}
+		m.Roles[role] = Role{Label: role}
 		m.Transitions[label] = &Transition{
-			Label:    label,
-			Position: Position{X: t.X, Y: t.Y},
-			Role:     Role{Label: role},
-			Delta:    m.EmptyVector(),
-			Guards:   GuardMap{},
+			Label:        label,
+			Position:     Position{X: t.X, Y: t.Y, Z: t.Z},
+			Role:         Role{Label: role},
+			Delta:        m.EmptyVector(),
+			Guards:       GuardMap{},
+			AllowReentry: t.AllowReentry,
+			Rate:         t.Rate,
+			Earliest:     t.Earliest,
+			Latest:       t.Latest,
+		}
+	}
+
+	for _, label := range SortedKeys(modelObject.Transitions) {
+		t := modelObject.Transitions[label]
+		if t.Subnet == nil {
+			continue
+		}
+		sub := New(t.Subnet.Net.ModelType).(*Model)
+		sub.collecting = m.collecting
+		data, _ := json.Marshal(t.Subnet.Net)
+		if !sub.loadJsonDefinition(string(data)) {
+			m.errors = append(m.errors, sub.errors...)
+			continue
 		}
+		m.Node(label).Subnet(t.Subnet.Type, sub.PetriNet, t.Subnet.Ports)
 	}
 
 	for _, a := range modelObject.Arcs {
 		source := m.Node(a.Source)
 		target := m.Node(a.Target)
+		if source == nil {
+			m.fail(UnknownElement, a.Source)
+			continue
+		}
+		if target == nil {
+			m.fail(UnknownElement, a.Target)
+			continue
+		}
 		if a.Weight == 0 {
 			a.Weight = 1
 		}
-		if a.Inhibit {
-			if source.IsPlace() {
-				if !target.IsTransition() {
-					panic(BadInhibitorTarget)
-				}
-				source.Guard(a.Weight, target)
-			}
-			if source.IsTransition() {
-				if !target.IsPlace() {
-					panic(BadInhibitorTarget)
-				}
-				source.Guard(a.Weight, target)
-			}
+		if a.Inhibit && modelObject.Version == DeclarationVersion {
+			m.inhibit(source, target, a.Weight, a.Read)
+		} else if a.Inhibit {
+			source.Guard(a.Weight, target)
+		} else if a.Bind != "" && a.Weight != 1 {
+			m.fail(BadBinding, a.Source, a.Target)
+		} else if a.Bind != "" {
+			source.Bind(a.Bind, target)
 		} else {
 			source.Tx(a.Weight, target)
 		}
 	}
 
+	if m.collecting && (len(m.errors) > 0 || len(m.validateStructure()) > 0) {
+		return false
+	}
 	m.Index()
 
 	return true
@@ -586,12 +841,18 @@ func (m *Model) UnpackFromUrl(url string) (sourceJson string, ok bool) {
 }
 
 func (m *Model) Guard(source Node, target Node, weight int64) {
+	if source == nil || target == nil {
+		m.fail(UnknownElement, LabelOf(source), LabelOf(target))
+		return
+	}
 	if weight < 0 {
-		panic(BadWeight)
+		m.fail(BadWeight, LabelOf(source), LabelOf(target))
+		return
 	}
 	if source.IsTransition() {
 		if !target.IsPlace() {
-			panic(BadInhibitorSource)
+			m.fail(BadInhibitorSource, LabelOf(source), LabelOf(target))
+			return
 		}
 		m.Arcs = append(m.Arcs, Arc{
 			Source:    source,
@@ -603,7 +864,8 @@ func (m *Model) Guard(source Node, target Node, weight int64) {
 	}
 	if source.IsPlace() {
 		if !target.IsTransition() {
-			panic(BadInhibitorTarget)
+			m.fail(BadInhibitorTarget, LabelOf(source), LabelOf(target))
+			return
 		}
 		m.Arcs = append(m.Arcs, Arc{
 			Source:    source,
@@ -615,6 +877,15 @@ func (m *Model) Guard(source Node, target Node, weight int64) {
 	}
 }
 
+// inhibit adds a guard arc asserting that the declared read flag agrees with the arc direction
+func (m *Model) inhibit(source Node, target Node, weight int64, read bool) {
+	if read != source.IsTransition() {
+		m.fail(BadInhibitorTarget, LabelOf(source), LabelOf(target))
+		return
+	}
+	m.Guard(source, target, weight)
+}
+
 func (m *Model) Node(oid string) Node {
 	if m.Places[oid] != nil {
 		return &node{
@@ -631,14 +902,21 @@ func (m *Model) Node(oid string) Node {
 	return nil
 }
 
-// Graph repopulates Arcs using delta vectors and guards
+// Graph repopulates Arcs using delta vectors and guards, keeping the bindings of existing flow arcs
 func (m *Model) Graph() Editor {
 	placeMap := make(map[int64]string)
 	for label, p := range m.Places {
 		placeMap[p.Offset] = label
 	}
+	binds := map[[2]string]string{}
+	for _, a := range m.Arcs {
+		if a.Bind != "" {
+			binds[[2]string{LabelOf(a.Source), LabelOf(a.Target)}] = a.Bind
+		}
+	}
 	m.Arcs = []Arc{}
-	for _, t := range m.Transitions {
+	for _, label := range SortedKeys(m.Transitions) {
+		t := m.Transitions[label]
 		for offset, d := range t.Delta {
 			if d < 0 {
 				m.Arcs = append(m.Arcs, Arc{
@@ -666,9 +944,24 @@ func (m *Model) Graph() Editor {
 				})
 			}
 		}
-		for _, g := range t.Guards {
+		for _, guardLabel := range SortedKeys(t.Guards) {
+			g := t.Guards[guardLabel]
 			for offset, d := range g.Delta {
-				if d < 0 {
+				if d < 0 && g.Inverted {
+					m.Arcs = append(m.Arcs, Arc{
+						Source: &node{
+							m:          m,
+							Transition: t,
+						},
+						Target: &node{
+							m:     m,
+							Place: m.Places[placeMap[int64(offset)]],
+						},
+						Weight:    0 - d,
+						Inhibitor: true,
+						Read:      true,
+					})
+				} else if d < 0 {
 					m.Arcs = append(m.Arcs, Arc{
 						Source: &node{
 							m:     m,
@@ -688,10 +981,15 @@ func (m *Model) Graph() Editor {
 			}
 		}
 	}
+	for i, a := range m.Arcs {
+		if !a.Inhibitor && a.Weight == 1 {
+			m.Arcs[i].Bind = binds[[2]string{LabelOf(a.Source), LabelOf(a.Target)}]
+		}
+	}
 	return m
 }
 
-// Index loads Arcs into delta vectors and guards
+// Index loads Arcs into delta vectors and guards, the delta of a transition is the sum of its flow arcs
 func (m *Model) Index() Editor {
 	for _, t := range m.Transitions {
 		t.Delta = m.EmptyVector()
@@ -716,22 +1014,97 @@ func (m *Model) Index() Editor {
 				arc.Target.GetTransition().Guards[g.Label] = g
 			}
 		} else {
+			// flow arcs accumulate so an input and an output on the same place cancel out
 			if arc.Source.IsPlace() {
-				arc.Target.GetTransition().Delta[arc.Source.GetPlace().Offset] = 0 - arc.Weight
+				arc.Target.GetTransition().Delta[arc.Source.GetPlace().Offset] -= arc.Weight
 			} else {
-				arc.Source.GetTransition().Delta[arc.Target.GetPlace().Offset] = arc.Weight
+				arc.Source.GetTransition().Delta[arc.Target.GetPlace().Offset] += arc.Weight
 			}
 		}
 	}
+	// a place consumed and restored by the same transition keeps its input demand as a read guard
+	for _, arc := range m.Arcs {
+		if arc.Inhibitor || !arc.Source.IsPlace() {
+			continue
+		}
+		t, p := arc.Target.GetTransition(), arc.Source.GetPlace()
+		if t.Delta[p.Offset] <= -arc.Weight {
+			continue
+		}
+		if g := t.Guards[p.Label]; g == nil {
+			g = &Guard{Label: p.Label, Delta: m.EmptyVector(), Inverted: true}
+			g.Delta[p.Offset] = 0 - arc.Weight
+			t.Guards[p.Label] = g
+		} else if g.Inverted && g.Delta[p.Offset] > -arc.Weight {
+			g.Delta[p.Offset] = 0 - arc.Weight
+		}
+	}
 	return m
 }
 
+// Normalize assigns place offsets in label order and sorts arcs so identical nets serialise identically
+func (m *Model) Normalize() Editor {
+	labels := SortedKeys(m.Places)
+	offsets := make([]int64, len(labels))
+	for i, label := range labels {
+		offsets[m.Places[label].Offset] = int64(i)
+	}
+	permute := func(v Vector) Vector {
+		if len(v) != len(offsets) {
+			return v
+		}
+		out := make(Vector, len(v))
+		for i, d := range v {
+			out[offsets[i]] = d
+		}
+		return out
+	}
+	for _, t := range m.Transitions {
+		t.Delta = permute(t.Delta)
+		for _, g := range t.Guards {
+			g.Delta = permute(g.Delta)
+		}
+	}
+	for i, label := range labels {
+		m.Places[label].Offset = int64(i)
+	}
+	// flow arcs are summed by Index so their order only matters for serialization
+	sort.SliceStable(m.Arcs, func(i, j int) bool {
+		return arcLess(m.Arcs[i], m.Arcs[j])
+	})
+	return m
+}
+
+// arcLess orders arcs by transition, place, flow before inhibitor and input before output
+func arcLess(a, b Arc) bool {
+	ta, pa := arcLabels(a)
+	tb, pb := arcLabels(b)
+	if ta != tb {
+		return ta < tb
+	}
+	if pa != pb {
+		return pa < pb
+	}
+	if a.Inhibitor != b.Inhibitor {
+		return !a.Inhibitor
+	}
+	// inputs before outputs so self-loops declared in either order serialize the same
+	return a.Source.IsPlace() && b.Source.IsTransition()
+}
+
+func arcLabels(a Arc) (transition string, place string) {
+	if a.Source.IsTransition() {
+		return a.Source.GetTransition().Label, a.Target.GetPlace().Label
+	}
+	return a.Target.GetTransition().Label, a.Source.GetPlace().Label
+}
+
 func (m *Model) Net() *PetriNet {
 	return m.PetriNet
 }
 
 func New(netType ...string) MetaModel {
-	modelType := "petriNet"
+	modelType := PetriNetType
 	if len(netType) == 1 {
 		modelType = netType[0]
 	}
@@ -804,14 +1177,8 @@ func (m *Model) Fn(def ...func(t *Transition)) Node {
 // Arc connects places and transitions
 // at runtime Arcs are indexed as adjacency matrix by converting Arcs to vectors
 func (m *Model) Arc(source Node, target Node, weight int64) {
-	if source.IsPlace() && target.IsPlace() {
-		panic(BadArcPlace)
-	}
-	if source.IsTransition() && target.IsTransition() {
-		panic(BadArcTransition)
-	}
-	if weight < 0 {
-		panic(BadWeight)
+	if !m.checkArc(source, target, weight) {
+		return
 	}
 	m.Arcs = append(m.Arcs, Arc{
 		Source:    source,
@@ -5,6 +5,7 @@ import (
 	"github.com/pflow-xyz/go-metamodel/compression"
 	"github.com/pflow-xyz/go-metamodel/metamodel"
 	"github.com/pflow-xyz/go-metamodel/vasm"
+	"math"
 	"testing"
 )
 
@@ -191,3 +192,330 @@ func TestUnzipUrl(t *testing.T) {
 	testCmd{call: p.Fire, action: "sub", expectPass: true}.tx(t)
 	testCmd{Process: p, action: "baz", expectFail: true}.assertInhibited(t)
 }
+
+func TestDefineE(t *testing.T) {
+	_, err := metamodel.New().DefineE(testModelDeclaration)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_, err = metamodel.New().DefineE(func(m metamodel.Declaration) {
+		foo := m.Cell().Label("foo")
+		bar := m.Cell().Label("bar")
+		baz := m.Fn().Label("baz")
+		foo.Tx(1, bar)
+		foo.Tx(-1, baz)
+		baz.Capacity(1)
+	})
+	errs, ok := err.(metamodel.ValidationErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected 3 validation errors got %v", err)
+	}
+	if errs[0].Reason != metamodel.BadArcPlace || errs[0].Labels[0] != "foo" || errs[0].Labels[1] != "bar" {
+		t.Fatalf("unexpected error %v", errs[0])
+	}
+	if errs[2].Reason != metamodel.ExpectedPlace || errs[2].Labels[0] != "baz" {
+		t.Fatalf("unexpected error %v", errs[2])
+	}
+	duplicate := func(m metamodel.Declaration) {
+		m.Cell().Label("foo")
+		m.Cell().Label("foo")
+	}
+	if mm := metamodel.New().Define(duplicate); len(mm.Net().Places) != 1 {
+		t.Fatalf("expected Define to replace the element")
+	}
+	_, err = metamodel.New().DefineE(duplicate)
+	if errs, ok := err.(metamodel.ValidationErrors); !ok || errs[0].Reason != metamodel.DuplicateLabel {
+		t.Fatalf("expected duplicate label got %v", err)
+	}
+	for _, r := range []float64{-1, math.NaN(), math.Inf(1)} {
+		_, err = metamodel.New().DefineE(func(m metamodel.Declaration) {
+			m.Fn().Label("spin").Rate(r)
+		})
+		if errs, ok := err.(metamodel.ValidationErrors); !ok || errs[0].Reason != metamodel.BadRate {
+			t.Fatalf("expected rate %v to be rejected got %v", r, err)
+		}
+	}
+	mm := metamodel.New().Define(testModelDeclaration)
+	for _, tx := range mm.Net().Transitions {
+		tx.Rate = -2
+	}
+	if errs := mm.Validate(); len(errs) == 0 || errs[0].Reason != metamodel.BadRate {
+		t.Fatalf("expected negative rate to fail validation got %v", errs)
+	}
+}
+
+func TestUnpackFromUrlE(t *testing.T) {
+	mm := metamodel.New()
+	if _, err := mm.UnpackFromUrlE(sampleUrl); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(mm.Validate()) != 0 {
+		t.Fatalf("expected valid model got %v", mm.Validate())
+	}
+	zdata, _ := compression.CompressBrotliEncode([]byte(`{"modelType": "petriNet", "version": "v0",
+		"places": {"foo": {"offset": 0}}, "transitions": {"bar": {}},
+		"arcs": [{"source": "foo", "target": "missing", "weight": 1}]}`))
+	_, err := metamodel.New().UnpackFromUrlE("?z=" + zdata)
+	errs, ok := err.(metamodel.ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].Reason != metamodel.UnknownElement || errs[0].Labels[0] != "missing" {
+		t.Fatalf("expected unknown element error got %v", err)
+	}
+	if _, err := mm.NodeE("missing"); err == nil {
+		t.Fatalf("expected lookup to fail")
+	}
+}
+
+func TestDeclarationRoundTrip(t *testing.T) {
+	mm := metamodel.New().Define(testModelDeclaration, func(m metamodel.Declaration) {
+		m.Fn(func(t *metamodel.Transition) {
+			t.Label = "reenter"
+			t.AllowReentry = true
+		}).Position(10, 20, 3).Guard(2, m.Cell().Label("gate").Position(40, 50, 6))
+	})
+	mm.Net().Path = "/p/"
+	mm.Net().Cid = "zb2rhisByHpwN7yahECwrYt7Uak2vE8ZQeo5SSaMaCyxEs6N2"
+	data, _ := mm.ToDeclaration()
+	url, ok := mm.ZipUrl()
+	if !ok {
+		t.Fatalf("failed to zip")
+	}
+	m2 := metamodel.New()
+	if _, err := m2.UnpackFromUrlE(url); err != nil {
+		t.Fatalf("failed to unzip %v", err)
+	}
+	data2, _ := m2.ToDeclaration()
+	if string(data) != string(data2) {
+		t.Fatalf("round trip mismatch\n%s\n%s", data, data2)
+	}
+	net := m2.Net()
+	g := net.Transitions["reenter"].Guards["gate"]
+	if g == nil || !g.Inverted || !net.Transitions["reenter"].AllowReentry || net.Places["gate"].Z != 6 || net.Cid != mm.Net().Cid {
+		t.Fatalf("lost fields in round trip: %s", data2)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	forward := metamodel.New().Define(func(m metamodel.Declaration) {
+		a := m.Cell().Label("a").Initial(1)
+		b := m.Cell().Label("b")
+		inc := m.Fn().Label("inc")
+		a.Tx(1, inc)
+		inc.Tx(1, b)
+		b.Guard(3, inc)
+	})
+	reverse := metamodel.New().Define(func(m metamodel.Declaration) {
+		b := m.Cell().Label("b")
+		a := m.Cell().Label("a").Initial(1)
+		inc := m.Fn().Label("inc")
+		b.Guard(3, inc)
+		inc.Tx(1, b)
+		a.Tx(1, inc)
+	})
+	u1, _ := forward.ZipUrl()
+	u2, _ := reverse.ZipUrl()
+	if u1 != u2 {
+		t.Fatalf("expected equivalent nets to serialize identically\n%s\n%s", u1, u2)
+	}
+	u1, _ = forward.Edit().Normalize().(metamodel.MetaModel).ZipUrl()
+	u2, _ = reverse.Edit().Normalize().(metamodel.MetaModel).ZipUrl()
+	if u1 != u2 {
+		t.Fatalf("expected identical urls\n%s\n%s", u1, u2)
+	}
+	p := vasm.Execute(reverse.Net())
+	testCmd{call: p.Fire, action: "inc", expectPass: true}.tx(t)
+	if p.TokenCount("b") != 1 || p.TokenCount("a") != 0 {
+		t.Fatalf("unexpected state after normalize %v", p.GetState())
+	}
+
+	loop := func(inputFirst bool) string {
+		mm := metamodel.New().Define(func(m metamodel.Declaration) {
+			a := m.Cell().Label("a").Initial(1)
+			spin := m.Fn().Label("spin")
+			if inputFirst {
+				a.Tx(1, spin)
+				spin.Tx(1, a)
+			} else {
+				spin.Tx(1, a)
+				a.Tx(1, spin)
+			}
+		})
+		u, _ := mm.Edit().Normalize().(metamodel.MetaModel).ZipUrl()
+		return u
+	}
+	if loop(true) != loop(false) {
+		t.Fatalf("expected self-loops to normalize to the same url")
+	}
+}
+
+func approvalDeclaration(m metamodel.Declaration) {
+	in := m.Cell().Label("in")
+	pending := m.Cell().Label("pending")
+	out := m.Cell().Label("out")
+	take := m.Fn().Label("take")
+	finish := m.Fn().Label("finish")
+	in.Tx(1, take)
+	take.Tx(1, pending)
+	pending.Tx(1, finish)
+	finish.Tx(1, out)
+}
+
+func TestSubnet(t *testing.T) {
+	approval := metamodel.New().Define(approvalDeclaration).Net()
+	mm := metamodel.New().Define(func(m metamodel.Declaration) {
+		start := m.Cell().Label("start").Initial(1)
+		mid := m.Cell().Label("mid")
+		done := m.Cell().Label("done")
+		first := m.Fn().Label("first").Subnet("approval", approval, map[string]string{"in": "start", "out": "mid"})
+		second := m.Fn().Label("second").Subnet("approval", approval, map[string]string{"in": "mid", "out": "done"})
+		start.Tx(1, first)
+		first.Tx(1, mid)
+		mid.Tx(1, second)
+		second.Tx(1, done)
+	})
+	flat := mm.Flatten().Net()
+	if len(flat.Places) != 5 || len(flat.Transitions) != 4 || flat.Places["first.pending"] == nil || flat.Places["done"].Offset != 0 {
+		t.Fatalf("unexpected flattened net %v", flat.Places)
+	}
+	if d := flat.Transitions["second.take"].Delta; d[flat.Places["mid"].Offset] != -1 || d[flat.Places["second.pending"].Offset] != 1 {
+		t.Fatalf("expected port to be fused with mid %v", d)
+	}
+
+	url, _ := mm.ZipUrl()
+	m2 := metamodel.New()
+	if _, err := m2.UnpackFromUrlE(url); err != nil {
+		t.Fatalf("failed to unzip %v", err)
+	}
+	sub := m2.Net().Transitions["second"].SubnetNode
+	if sub == nil || sub.SubnetType != "approval" || sub.Ports["in"] != "mid" || len(sub.Places) != 3 {
+		t.Fatalf("lost subnet in round trip")
+	}
+	data, _ := mm.Flatten().ToDeclaration()
+	data2, _ := m2.Flatten().ToDeclaration()
+	if string(data) != string(data2) {
+		t.Fatalf("round trip mismatch\n%s\n%s", data, data2)
+	}
+
+	_, err := metamodel.New().DefineE(func(m metamodel.Declaration) {
+		m.Fn().Label("broken").Subnet("approval", approval, map[string]string{"in": "missing"})
+	})
+	if err == nil {
+		t.Fatalf("expected unknown socket to fail")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	billing := metamodel.New().Define(func(m metamodel.Declaration) {
+		inbox := m.Cell().Label("inbox").Initial(1)
+		paid := m.Cell().Label("paid")
+		pay := m.Fn().Label("pay")
+		inbox.Tx(1, pay)
+		pay.Tx(1, paid)
+	})
+	shipping := metamodel.New().Define(func(m metamodel.Declaration) {
+		paid := m.Cell().Label("paid")
+		shipped := m.Cell().Label("shipped")
+		ship := m.Fn().Label("ship")
+		paid.Tx(1, ship)
+		ship.Tx(1, shipped)
+	})
+	mm, err := metamodel.Compose([]metamodel.Component{
+		{Namespace: "billing", Model: billing},
+		{Namespace: "shipping", Model: shipping},
+	}, metamodel.ByLabel)
+	if err != nil {
+		t.Fatalf("compose failed %v", err)
+	}
+	net := mm.Net()
+	if len(net.Places) != 3 || net.Places["paid"] == nil || net.Places["shipping.shipped"].Offset != 2 {
+		t.Fatalf("unexpected places %v", net.Places)
+	}
+	p := vasm.Execute(net)
+	for _, action := range []string{"billing.pay", "shipping.ship"} {
+		if ok, msg, _ := p.Fire(metamodel.Op{Action: action}); !ok {
+			t.Fatalf("fire %s failed %s", action, msg)
+		}
+	}
+	if p.TokenCount("shipping.shipped") != 1 {
+		t.Fatalf("expected the shared place to hand over the token")
+	}
+
+	mm, err = metamodel.Compose([]metamodel.Component{
+		{Namespace: "a", Model: billing, Fuse: map[string]string{"paid": "ready", "pay": "go"}},
+		{Namespace: "b", Model: billing, Fuse: map[string]string{"inbox": "ready", "pay": "go"}},
+	})
+	if err != nil {
+		t.Fatalf("compose failed %v", err)
+	}
+	net = mm.Net()
+	if len(net.Transitions) != 1 || net.Places["a.inbox"] == nil || net.Places["b.paid"] == nil || net.Places["ready"].Initial != 1 {
+		t.Fatalf("unexpected fusion %v", net.Places)
+	}
+	if d := net.Transitions["go"].Delta; d[net.Places["a.inbox"].Offset] != -1 || d[net.Places["b.paid"].Offset] != 1 || d[net.Places["ready"].Offset] != 0 {
+		t.Fatalf("expected fused transition to carry both deltas %v", d)
+	}
+	p = vasm.Execute(net)
+	if ok, msg, _ := p.Fire(metamodel.Op{Action: "go"}); !ok || p.TokenCount("ready") != 1 || p.TokenCount("b.paid") != 1 {
+		t.Fatalf("expected go to pass the token through ready: %s", msg)
+	}
+	empty := net.EmptyVector()
+	empty[net.Places["a.inbox"].Offset] = 1
+	p = vasm.Execute(net, empty)
+	if ok, _, _ := p.Fire(metamodel.Op{Action: "go"}); ok {
+		t.Fatalf("expected go to need a token in ready")
+	}
+
+	_, err = metamodel.Compose([]metamodel.Component{
+		{Model: billing},
+		{Model: metamodel.New().Define(func(m metamodel.Declaration) {
+			m.Cell().Label("inbox").Initial(2)
+		})},
+	}, metamodel.ByLabel)
+	if err == nil {
+		t.Fatalf("expected conflicting initial tokens to fail")
+	}
+	_, err = metamodel.Compose([]metamodel.Component{{Model: billing}, {Model: billing}})
+	if err == nil {
+		t.Fatalf("expected duplicate labels without namespaces to fail")
+	}
+
+	approval := metamodel.New().Define(approvalDeclaration).Net()
+	review := metamodel.New().Define(func(m metamodel.Declaration) {
+		start := m.Cell().Label("start").Initial(1)
+		done := m.Cell().Label("done")
+		r := m.Fn().Label("review").Subnet("approval", approval, map[string]string{"in": "start", "out": "done"})
+		start.Tx(1, r)
+		r.Tx(1, done)
+	})
+	mm, err = metamodel.Compose([]metamodel.Component{{Namespace: "x", Model: review}})
+	if err != nil {
+		t.Fatalf("compose failed %v", err)
+	}
+	if ports := mm.Net().Transitions["x.review"].Ports; ports["in"] != "x.start" || ports["out"] != "x.done" {
+		t.Fatalf("expected ports to follow renamed places got %v", ports)
+	}
+	if flat := mm.Flatten().Net(); flat.Places["x.review.pending"] == nil {
+		t.Fatalf("expected namespaced subnet to flatten got %v", flat.Places)
+	}
+	dangling := metamodel.New().Define(func(m metamodel.Declaration) {
+		start := m.Cell().Label("start")
+		m.Fn().Label("review").Subnet("approval", approval, map[string]string{"in": "start"})
+		start.Label("begin")
+	})
+	mm, err = metamodel.Compose([]metamodel.Component{{Namespace: "x", Model: dangling}})
+	if errs, ok := err.(metamodel.ValidationErrors); !ok || mm != nil || errs[0].Reason != metamodel.UnknownElement || errs[0].Labels[2] != "start" {
+		t.Fatalf("expected a port bound to an undefined place to fail got %v", err)
+	}
+
+	rated := func(rate float64) metamodel.MetaModel {
+		return metamodel.New().Define(func(m metamodel.Declaration) {
+			m.Fn().Label("pay").Rate(rate)
+		})
+	}
+	_, err = metamodel.Compose([]metamodel.Component{{Model: rated(2)}, {Model: rated(3)}}, metamodel.FuseTransitions)
+	if errs, ok := err.(metamodel.ValidationErrors); !ok || errs[0].Reason != metamodel.FusionConflict || errs[0].Labels[1] != "rate" {
+		t.Fatalf("expected conflicting rates to fail got %v", err)
+	}
+	if mm, err = metamodel.Compose([]metamodel.Component{{Model: rated(2)}, {Model: rated(0)}}, metamodel.FuseTransitions); err != nil || mm.Net().Transitions["pay"].Rate != 2 {
+		t.Fatalf("expected unset rate to defer got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package metamodel
+
+import "encoding/json"
+
+// Subnet turns a transition into a substitution transition embedding net
+// ports bind places of the subnet to places of the enclosing net
+func (n *node) Subnet(subnetType string, net *PetriNet, ports map[string]string) Node {
+	if !n.IsTransition() {
+		n.m.fail(ExpectedTransition, n.Place.Label)
+		return n
+	}
+	if net == nil {
+		n.m.fail(UnknownElement, n.Transition.Label)
+		return n
+	}
+	for _, port := range SortedKeys(ports) {
+		if net.Places[port] == nil || n.m.Places[ports[port]] == nil {
+			n.m.fail(UnknownElement, n.Transition.Label, port, ports[port])
+			return n
+		}
+	}
+	n.Transition.SubnetNode = &SubnetNode{PetriNet: net, SubnetType: subnetType, Ports: ports}
+	return n
+}
+
+// Flatten returns a model where substitution transitions are replaced by the elements of their subnets
+// subnet elements are prefixed with the labels of the transitions enclosing them, e.g. "review.approve",
+// port places are fused with the places they are bound to and arcs of substitution transitions are dropped
+func (m *Model) Flatten() MetaModel {
+	obj := DeclarationObject{
+		ModelType:   m.ModelType,
+		Version:     DeclarationVersion,
+		Places:      PlaceMapDefinition{},
+		Transitions: TransitionMapDefinition{},
+		Arcs:        ArcListDefinition{},
+		Path:        m.Path,
+		Cid:         m.Cid,
+	}
+	flatten(m.ToDeclarationObject(), "", func(label string) string { return label }, &obj)
+
+	// places of the enclosing net keep their offsets so its vectors stay valid
+	offset := int64(len(m.Places))
+	for _, label := range SortedKeys(obj.Places) {
+		if m.Places[label] == nil {
+			p := obj.Places[label]
+			p.Offset = offset
+			obj.Places[label] = p
+			offset++
+		}
+	}
+	flat := New(m.ModelType).(*Model)
+	flat.collecting = m.collecting
+	data, _ := json.Marshal(obj)
+	flat.loadJsonDefinition(string(data))
+	m.errors = append(m.errors, flat.errors...)
+	return flat
+}
+
+// flatten copies a declaration into obj renaming places with resolve and transitions with prefix
+func flatten(d DeclarationObject, prefix string, resolve func(string) string, obj *DeclarationObject) {
+	for label, p := range d.Places {
+		if name := resolve(label); name == prefix+label {
+			obj.Places[name] = p
+		}
+	}
+	for _, label := range SortedKeys(d.Transitions) {
+		t := d.Transitions[label]
+		if t.Subnet == nil {
+			obj.Transitions[prefix+label] = t
+			continue
+		}
+		ports := t.Subnet.Ports
+		inner := prefix + label + "."
+		flatten(t.Subnet.Net, inner, func(l string) string {
+			if socket, ok := ports[l]; ok {
+				return resolve(socket)
+			}
+			return inner + l
+		}, obj)
+	}
+	name := func(label string) string {
+		if _, ok := d.Places[label]; ok {
+			return resolve(label)
+		}
+		return prefix + label
+	}
+	for _, a := range d.Arcs {
+		if t, ok := d.Transitions[a.Source]; ok && t.Subnet != nil {
+			continue
+		}
+		if t, ok := d.Transitions[a.Target]; ok && t.Subnet != nil {
+			continue
+		}
+		a.Source = name(a.Source)
+		a.Target = name(a.Target)
+		obj.Arcs = append(obj.Arcs, a)
+	}
+}
@@ -0,0 +1,233 @@
+package metamodel
+
+import (
+	"github.com/pflow-xyz/go-metamodel/compression"
+	"sort"
+	"strings"
+)
+
+// ValidationError describes an invalid model element
+type ValidationError struct {
+	Reason string   `json:"reason"`
+	Labels []string `json:"labels"`
+	Err    error    `json:"-"`
+}
+
+func (e ValidationError) Error() string {
+	msg := e.Reason
+	if len(e.Labels) > 0 {
+		msg += ": " + strings.Join(e.Labels, ", ")
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is returned when a model fails validation
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// fail panics with the reason unless errors are being collected
+func (m *Model) fail(reason string, labels ...string) {
+	if !m.collecting {
+		panic(reason)
+	}
+	m.errors = append(m.errors, ValidationError{Reason: reason, Labels: labels})
+}
+
+// collect runs a model declaration recording invalid elements instead of panicking
+func (m *Model) collect(declare func() bool) error {
+	m.collecting = true
+	m.errors = []ValidationError{}
+	defer func() {
+		m.collecting = false
+		m.errors = nil
+	}()
+	ok := declare()
+	errs := m.errors
+	if len(errs) == 0 {
+		errs = m.validateStructure()
+	}
+	if len(errs) == 0 {
+		m.Index()
+		errs = m.Validate()
+	}
+	if len(errs) == 0 && !ok {
+		errs = append(errs, ValidationError{Reason: BadDeclaration})
+	}
+	if len(errs) > 0 {
+		return ValidationErrors(errs)
+	}
+	return nil
+}
+
+// LabelOf returns the label of a place or transition node, empty for nil
+func LabelOf(n Node) string {
+	if n == nil {
+		return ""
+	}
+	if n.IsPlace() {
+		return n.GetPlace().Label
+	}
+	return n.GetTransition().Label
+}
+
+func (m *Model) checkArc(source Node, target Node, weight int64) bool {
+	if source == nil || target == nil {
+		m.fail(UnknownElement, LabelOf(source), LabelOf(target))
+		return false
+	}
+	if source.IsPlace() && target.IsPlace() {
+		m.fail(BadArcPlace, LabelOf(source), LabelOf(target))
+		return false
+	}
+	if source.IsTransition() && target.IsTransition() {
+		m.fail(BadArcTransition, LabelOf(source), LabelOf(target))
+		return false
+	}
+	if weight < 0 {
+		m.fail(BadWeight, LabelOf(source), LabelOf(target))
+		return false
+	}
+	return true
+}
+
+// DefineE declares a model returning invalid declarations as ValidationErrors instead of panicking
+func (m *Model) DefineE(def ...func(declaration Declaration)) (MetaModel, error) {
+	err := m.collect(func() bool {
+		for _, definition := range def {
+			definition(m)
+		}
+		return true
+	})
+	return m, err
+}
+
+// UnpackFromUrlE loads a zipped model returning invalid declarations as ValidationErrors instead of panicking
+func (m *Model) UnpackFromUrlE(url string) (sourceJson string, err error) {
+	sourceJson, ok := compression.DecompressEncodedUrl(url)
+	if !ok {
+		return sourceJson, ValidationErrors{{Reason: BadDeclaration, Labels: []string{url}}}
+	}
+	err = m.collect(func() bool {
+		return m.loadJsonDefinition(sourceJson)
+	})
+	return sourceJson, err
+}
+
+// NodeE looks up an element by label returning an error if it does not exist
+func (m *Model) NodeE(oid string) (Node, error) {
+	n := m.Node(oid)
+	if n == nil {
+		return nil, ValidationError{Reason: UnknownElement, Labels: []string{oid}}
+	}
+	return n, nil
+}
+
+// Validate checks the model for inconsistencies that would break execution
+func (m *Model) Validate() []ValidationError {
+	errs := m.validateStructure()
+	if len(errs) > 0 {
+		return errs
+	}
+	for _, label := range SortedKeys(m.Transitions) {
+		t := m.Transitions[label]
+		if len(t.Delta) != len(m.Places) {
+			errs = append(errs, ValidationError{Reason: BadDelta, Labels: []string{label}})
+		}
+		if !validRate(t.Rate) {
+			errs = append(errs, ValidationError{Reason: BadRate, Labels: []string{label}})
+		}
+		if t.Earliest < 0 || t.Latest < 0 || (t.Latest > 0 && t.Latest < t.Earliest) {
+			errs = append(errs, ValidationError{Reason: BadDelay, Labels: []string{label}})
+		}
+		for _, g := range t.Guards {
+			if m.Places[g.Label] == nil {
+				errs = append(errs, ValidationError{Reason: UnknownElement, Labels: []string{label, g.Label}})
+			} else if len(g.Delta) != len(m.Places) {
+				errs = append(errs, ValidationError{Reason: BadDelta, Labels: []string{label, g.Label}})
+			}
+		}
+	}
+	return errs
+}
+
+// validateStructure checks places and arcs which must be sound before the model can be indexed
+func (m *Model) validateStructure() (errs []ValidationError) {
+	offsets := map[int64]string{}
+	// workflow and elementary places hold at most one token, elementary nets one token in total
+	safe := m.ModelType == WorkflowType || m.ModelType == ElementaryType
+	marked := []string{}
+	for _, label := range SortedKeys(m.Places) {
+		p := m.Places[label]
+		if p.Offset < 0 || p.Offset >= int64(len(m.Places)) {
+			errs = append(errs, ValidationError{Reason: BadOffset, Labels: []string{label}})
+		} else if other, ok := offsets[p.Offset]; ok {
+			errs = append(errs, ValidationError{Reason: BadOffset, Labels: []string{other, label}})
+		} else {
+			offsets[p.Offset] = label
+		}
+		if p.Capacity < 0 {
+			errs = append(errs, ValidationError{Reason: BadCapacity, Labels: []string{label}})
+		}
+		if p.Initial < 0 || (p.Capacity > 0 && p.Initial > p.Capacity) || (safe && p.Initial > 1) {
+			errs = append(errs, ValidationError{Reason: BadInitial, Labels: []string{label}})
+		} else if p.Initial > 0 {
+			marked = append(marked, label)
+		}
+		if m.Transitions[label] != nil {
+			errs = append(errs, ValidationError{Reason: DuplicateLabel, Labels: []string{label}})
+		}
+	}
+	if m.ModelType == ElementaryType && len(marked) > 1 {
+		errs = append(errs, ValidationError{Reason: BadInitial, Labels: marked})
+	}
+	for _, a := range m.Arcs {
+		source, target := LabelOf(a.Source), LabelOf(a.Target)
+		switch {
+		case a.Source == nil || a.Target == nil:
+			errs = append(errs, ValidationError{Reason: UnknownElement, Labels: []string{source, target}})
+		case !m.contains(a.Source) || !m.contains(a.Target):
+			errs = append(errs, ValidationError{Reason: UnknownElement, Labels: []string{source, target}})
+		case a.Source.IsPlace() && a.Target.IsPlace():
+			errs = append(errs, ValidationError{Reason: BadArcPlace, Labels: []string{source, target}})
+		case a.Source.IsTransition() && a.Target.IsTransition():
+			errs = append(errs, ValidationError{Reason: BadArcTransition, Labels: []string{source, target}})
+		case a.Weight < 0:
+			errs = append(errs, ValidationError{Reason: BadWeight, Labels: []string{source, target}})
+		case a.Inhibitor && a.Read != a.Source.IsTransition():
+			errs = append(errs, ValidationError{Reason: BadInhibitorTarget, Labels: []string{source, target}})
+		}
+	}
+	return errs
+}
+
+// contains tests that a node still belongs to the model under its current label
+func (m *Model) contains(n Node) bool {
+	if n.IsPlace() {
+		return m.Places[n.GetPlace().Label] == n.GetPlace()
+	}
+	return m.Transitions[n.GetTransition().Label] == n.GetTransition()
+}
+
+// SortedKeys returns the labels of a place or transition map in sorted order
+func SortedKeys[T any](elements map[string]T) []string {
+	labels := make([]string, 0, len(elements))
+	for label := range elements {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
@@ -26,6 +26,7 @@ func (m *Model) MetaModel() (string, metamodel.MetaModel) {
 func (m *Model) Declare(args ...func(metamodel.Declaration)) {
 	mm := metamodel.New()
 	mm.Define(args...)
+	mm.Edit().Normalize()
 	url, _ := mm.ZipUrl()
 	m.Base64Zipped = url[3:]
 	m.IpfsCid = oid.ToOid(oid.Marshal(m.Base64Zipped)).String()
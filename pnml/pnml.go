@@ -0,0 +1,336 @@
+package pnml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/pflow-xyz/go-metamodel/metamodel"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	Namespace          = "http://www.pnml.org/version-2009/grammar/pnml"
+	NetType            = "http://www.pnml.org/version-2009/grammar/ptnet"
+	Tool               = "pflow"
+	NoNet              = "document does not contain a net"
+	BadValue           = "cannot parse value %q"
+	UnsupportedCharset = "unsupported charset %q"
+)
+
+// arc types used by PIPE, WoPeD and other tools extending ptnet
+const (
+	normalArc    = "normal"
+	inhibitorArc = "inhibitor"
+	readArc      = "read"
+	testArc      = "test"
+)
+
+type document struct {
+	XMLName xml.Name `xml:"pnml"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Nets    []net    `xml:"net"`
+}
+
+type page struct {
+	Id          string       `xml:"id,attr"`
+	Places      []place      `xml:"place"`
+	Transitions []transition `xml:"transition"`
+	Arcs        []arc        `xml:"arc"`
+	Pages       []page       `xml:"page"`
+}
+
+type net struct {
+	Id   string      `xml:"id,attr"`
+	Type string      `xml:"type,attr"`
+	Name *annotation `xml:"name"`
+	page
+}
+
+type annotation struct {
+	Text     string    `xml:"text,omitempty"`
+	Value    string    `xml:"value,omitempty"`
+	Graphics *graphics `xml:"graphics,omitempty"`
+}
+
+type graphics struct {
+	Position *coordinate `xml:"position,omitempty"`
+	Offset   *coordinate `xml:"offset,omitempty"`
+}
+
+type coordinate struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+type toolSpecific struct {
+	Tool    string `xml:"tool,attr"`
+	Version string `xml:"version,attr"`
+	Role    string `xml:"role,omitempty"`
+}
+
+type place struct {
+	Id             string      `xml:"id,attr"`
+	Name           *annotation `xml:"name"`
+	Graphics       *graphics   `xml:"graphics"`
+	InitialMarking *annotation `xml:"initialMarking"`
+	Capacity       *annotation `xml:"capacity"`
+}
+
+type transition struct {
+	Id           string         `xml:"id,attr"`
+	Name         *annotation    `xml:"name"`
+	Graphics     *graphics      `xml:"graphics"`
+	ToolSpecific []toolSpecific `xml:"toolspecific"`
+}
+
+type arcType struct {
+	Value string `xml:"value,attr"`
+}
+
+type arc struct {
+	Id          string      `xml:"id,attr"`
+	Source      string      `xml:"source,attr"`
+	Target      string      `xml:"target,attr"`
+	Inscription *annotation `xml:"inscription"`
+	Type        *arcType    `xml:"type"`
+}
+
+// flatten collects elements from nested pages into a single page
+func (p page) flatten() page {
+	out := page{Places: p.Places, Transitions: p.Transitions, Arcs: p.Arcs}
+	for _, sub := range p.Pages {
+		f := sub.flatten()
+		out.Places = append(out.Places, f.Places...)
+		out.Transitions = append(out.Transitions, f.Transitions...)
+		out.Arcs = append(out.Arcs, f.Arcs...)
+	}
+	return out
+}
+
+// value reads an annotation, PIPE writes values like "Default,3"
+func (a *annotation) value() (int64, error) {
+	if a == nil {
+		return 0, nil
+	}
+	s := strings.TrimSpace(a.Text)
+	if s == "" {
+		s = strings.TrimSpace(a.Value)
+	}
+	if i := strings.LastIndex(s, ","); i >= 0 {
+		s = s[i+1:]
+	}
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf(BadValue, s)
+	}
+	return v, nil
+}
+
+func (a *annotation) text() string {
+	if a == nil {
+		return ""
+	}
+	if a.Text == "" {
+		return strings.TrimSpace(a.Value)
+	}
+	return strings.TrimSpace(a.Text)
+}
+
+func (g *graphics) position() (x int64, y int64) {
+	if g == nil || g.Position == nil {
+		return 0, 0
+	}
+	return int64(math.Round(g.Position.X)), int64(math.Round(g.Position.Y))
+}
+
+// labels maps element ids to model labels using names when they are unique
+func labels(ids []string, names []string) map[string]string {
+	count := map[string]int{}
+	for _, n := range names {
+		count[n]++
+	}
+	for _, id := range ids {
+		count[id]++
+	}
+	out := map[string]string{}
+	for i, id := range ids {
+		if names[i] != "" && count[names[i]] == 1 {
+			out[id] = names[i]
+		} else {
+			out[id] = id
+		}
+	}
+	return out
+}
+
+// charsetReader accepts the latin-1 declaration written by PIPE
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "us-ascii":
+		return input, nil
+	case "iso-8859-1", "latin1":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.NewReader(string(runes)), nil
+	}
+	return nil, fmt.Errorf(UnsupportedCharset, charset)
+}
+
+// Read imports the first net of a PNML document
+func Read(r io.Reader) (metamodel.MetaModel, error) {
+	doc := document{}
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charsetReader
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Nets) == 0 {
+		return nil, errors.New(NoNet)
+	}
+	n := doc.Nets[0].page.flatten()
+	ids, names := []string{}, []string{}
+	for _, p := range n.Places {
+		ids, names = append(ids, p.Id), append(names, p.Name.text())
+	}
+	for _, t := range n.Transitions {
+		ids, names = append(ids, t.Id), append(names, t.Name.text())
+	}
+	label := labels(ids, names)
+
+	var parseErr error
+	setErr := func(err error) {
+		if parseErr == nil {
+			parseErr = err
+		}
+	}
+	mm, err := metamodel.New().DefineE(func(m metamodel.Declaration) {
+		nodes := map[string]metamodel.Node{}
+		for _, p := range n.Places {
+			initial, err := p.InitialMarking.value()
+			setErr(err)
+			capacity, err := p.Capacity.value()
+			setErr(err)
+			x, y := p.Graphics.position()
+			nodes[p.Id] = m.Cell().Label(label[p.Id]).Position(x, y).Initial(initial).Capacity(capacity)
+		}
+		for _, t := range n.Transitions {
+			x, y := t.Graphics.position()
+			nodes[t.Id] = m.Fn().Label(label[t.Id]).Position(x, y)
+			for _, ts := range t.ToolSpecific {
+				if ts.Tool == Tool && ts.Role != "" {
+					nodes[t.Id].Role(ts.Role)
+				}
+			}
+		}
+		for _, a := range n.Arcs {
+			weight, err := a.Inscription.value()
+			setErr(err)
+			if weight == 0 {
+				weight = 1
+			}
+			source, target := nodes[a.Source], nodes[a.Target]
+			if source == nil || target == nil {
+				setErr(metamodel.ValidationError{Reason: metamodel.UnknownElement, Labels: []string{a.Source, a.Target}})
+				continue
+			}
+			kind := normalArc
+			if a.Type != nil {
+				kind = a.Type.Value
+			}
+			switch kind {
+			case inhibitorArc:
+				source.Guard(weight, target)
+			case readArc, testArc:
+				// read arcs point from place to transition in PNML but are declared on the transition
+				target.Guard(weight, source)
+			default:
+				source.Tx(weight, target)
+			}
+		}
+	})
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mm, nil
+}
+
+// Write exports a model as a PNML document
+func Write(w io.Writer, mm metamodel.MetaModel) error {
+	pn := mm.Net()
+	out := document{
+		Xmlns: Namespace,
+		Nets: []net{{
+			Id:   "net",
+			Type: NetType,
+			page: page{Pages: []page{{Id: "page"}}},
+		}},
+	}
+	pg := &out.Nets[0].Pages[0]
+	for _, label := range metamodel.SortedKeys(pn.Places) {
+		p := pn.Places[label]
+		el := place{
+			Id:       label,
+			Name:     &annotation{Text: label},
+			Graphics: &graphics{Position: &coordinate{X: float64(p.X), Y: float64(p.Y)}},
+		}
+		if p.Initial != 0 {
+			el.InitialMarking = &annotation{Text: fmt.Sprint(p.Initial)}
+		}
+		if p.Capacity != 0 {
+			el.Capacity = &annotation{Text: fmt.Sprint(p.Capacity)}
+		}
+		pg.Places = append(pg.Places, el)
+	}
+	for _, label := range metamodel.SortedKeys(pn.Transitions) {
+		t := pn.Transitions[label]
+		el := transition{
+			Id:       label,
+			Name:     &annotation{Text: label},
+			Graphics: &graphics{Position: &coordinate{X: float64(t.X), Y: float64(t.Y)}},
+		}
+		if t.Role.Label != "" && t.Role.Label != "default" {
+			el.ToolSpecific = []toolSpecific{{Tool: Tool, Version: "1", Role: t.Role.Label}}
+		}
+		pg.Transitions = append(pg.Transitions, el)
+	}
+	for i, a := range pn.Arcs {
+		weight := a.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		el := arc{
+			Id:          fmt.Sprintf("arc%v", i),
+			Source:      metamodel.LabelOf(a.Source),
+			Target:      metamodel.LabelOf(a.Target),
+			Inscription: &annotation{Text: fmt.Sprint(weight)},
+		}
+		if a.Inhibitor && a.Read {
+			el.Source, el.Target = el.Target, el.Source
+			el.Type = &arcType{Value: readArc}
+		} else if a.Inhibitor {
+			el.Type = &arcType{Value: inhibitorArc}
+		}
+		pg.Arcs = append(pg.Arcs, el)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,89 @@
+package pnml_test
+
+import (
+	"bytes"
+	"github.com/pflow-xyz/go-metamodel/metamodel"
+	"github.com/pflow-xyz/go-metamodel/pnml"
+	"github.com/pflow-xyz/go-metamodel/vasm"
+	"strings"
+	"testing"
+)
+
+// pipeSample is written in the style exported by PIPE with values like "Default,1"
+const pipeSample = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<pnml>
+<net id="Net-One" type="P/T net">
+<place id="P0">
+<graphics><position x="120.0" y="90.0"/></graphics>
+<name><value>ready</value></name>
+<initialMarking><value>Default,2</value></initialMarking>
+<capacity><value>0</value></capacity>
+</place>
+<place id="P1">
+<graphics><position x="300.0" y="90.0"/></graphics>
+<name><value>done</value></name>
+<initialMarking><value>Default,0</value></initialMarking>
+<capacity><value>1</value></capacity>
+</place>
+<transition id="T0">
+<graphics><position x="210.0" y="90.0"/></graphics>
+<name><value>work</value></name>
+</transition>
+<arc id="P0 to T0" source="P0" target="T0">
+<inscription><value>Default,1</value></inscription>
+<type value="normal"/>
+</arc>
+<arc id="T0 to P1" source="T0" target="P1">
+<inscription><value>Default,1</value></inscription>
+<type value="normal"/>
+</arc>
+<arc id="P1 to T0" source="P1" target="T0">
+<inscription><value>Default,1</value></inscription>
+<type value="inhibitor"/>
+</arc>
+</net>
+</pnml>`
+
+func TestRead(t *testing.T) {
+	mm, err := pnml.Read(strings.NewReader(pipeSample))
+	if err != nil {
+		t.Fatalf("failed to read %v", err)
+	}
+	net := mm.Net()
+	if net.Places["ready"].Initial != 2 || net.Places["done"].Capacity != 1 || net.Transitions["work"].X != 210 {
+		t.Fatalf("unexpected import %v", net.Places)
+	}
+	p := vasm.Execute(net)
+	if ok, msg, _ := p.Fire(metamodel.Op{Action: "work"}); !ok {
+		t.Fatalf("expected work to fire: %s", msg)
+	}
+	if ok, _, _ := p.Fire(metamodel.Op{Action: "work"}); ok {
+		t.Fatalf("expected work to be inhibited")
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	mm := metamodel.New().Define(func(m metamodel.Declaration) {
+		a := m.Cell().Label("a").Initial(1).Position(10, 20)
+		b := m.Cell().Label("b").Capacity(3)
+		move := m.Fn().Label("move").Role("admin").Position(30, 40)
+		a.Tx(2, move)
+		move.Tx(1, b)
+		move.Guard(1, m.Cell().Label("key"))
+		b.Guard(3, move)
+	})
+	buf := new(bytes.Buffer)
+	if err := pnml.Write(buf, mm); err != nil {
+		t.Fatalf("failed to write %v", err)
+	}
+	t.Logf("%s", buf.String())
+	m2, err := pnml.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read %v", err)
+	}
+	d1, _ := mm.Edit().Normalize().(metamodel.MetaModel).ToDeclaration()
+	d2, _ := m2.Edit().Normalize().(metamodel.MetaModel).ToDeclaration()
+	if string(d1) != string(d2) {
+		t.Fatalf("round trip mismatch\n%s\n%s", d1, d2)
+	}
+}
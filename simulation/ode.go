@@ -0,0 +1,187 @@
+package simulation
+
+import (
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"math"
+)
+
+// Solver configures the adaptive Dormand-Prince integration
+type Solver struct {
+	AbsTol   float64 // absolute error allowed per step
+	RelTol   float64 // error allowed per step relative to the token count
+	Step     float64 // initial step size, 0 picks one from the horizon
+	MaxSteps int     // accepted and rejected steps before giving up
+}
+
+// Tolerance sets the absolute and relative error allowed per step
+func Tolerance(abs, rel float64) func(*Solver) {
+	return func(s *Solver) {
+		s.AbsTol = abs
+		s.RelTol = rel
+	}
+}
+
+// Series holds token counts per place label sampled at every accepted step
+type Series struct {
+	Time     []float64            `json:"time"`
+	Values   map[string][]float64 `json:"values"`
+	Complete bool                 `json:"complete"` // false when MaxSteps ran out before the horizon
+}
+
+// At interpolates the token count of a place at time t, times outside the series are clamped to its ends
+func (s Series) At(label string, t float64) float64 {
+	values := s.Values[label]
+	if len(values) == 0 {
+		return 0
+	}
+	if t <= s.Time[0] {
+		return values[0]
+	}
+	for i := 1; i < len(s.Time); i++ {
+		if t <= s.Time[i] {
+			f := (t - s.Time[i-1]) / (s.Time[i] - s.Time[i-1])
+			return values[i-1] + f*(values[i]-values[i-1])
+		}
+	}
+	return values[len(values)-1]
+}
+
+// inputs collects the tokens each transition needs per place from its input arcs and read guards
+// a place both consumed and read counts once with the larger weight
+func inputs(net *PetriNet, txns []*Transition) []Vector {
+	out := make([]Vector, len(txns))
+	for k, t := range txns {
+		out[k] = make(Vector, len(net.Places))
+		for _, g := range t.Guards {
+			if g.Inverted {
+				out[k][net.Places[g.Label].Offset] = -g.Delta[net.Places[g.Label].Offset]
+			}
+		}
+		for _, a := range net.Arcs {
+			if !a.Inhibitor && a.Source.IsPlace() && a.Target.GetTransition() == t {
+				if i := a.Source.GetPlace().Offset; a.Weight > out[k][i] {
+					out[k][i] = a.Weight
+				}
+			}
+		}
+	}
+	return out
+}
+
+// flux returns the mass-action firing speed of every transition
+// the speed is the rate times the product of input tokens raised to the arc weight
+// inhibitor guards and capacities have no continuous counterpart and are ignored
+func flux(x []float64, txns []*Transition, in []Vector) []float64 {
+	out := make([]float64, len(txns))
+	for k, t := range txns {
+		v := rate(t)
+		for i, w := range in[k] {
+			if w > 0 {
+				v *= math.Pow(math.Max(x[i], 0), float64(w))
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func derivative(x []float64, txns []*Transition, in []Vector) []float64 {
+	dx := make([]float64, len(x))
+	for k, v := range flux(x, txns, in) {
+		for i, d := range txns[k].Delta {
+			dx[i] += float64(d) * v
+		}
+	}
+	return dx
+}
+
+// Dormand-Prince 5(4) tableau
+var (
+	dpC = [7]float64{0, 1.0 / 5, 3.0 / 10, 4.0 / 5, 8.0 / 9, 1, 1}
+	dpA = [7][6]float64{
+		{},
+		{1.0 / 5},
+		{3.0 / 40, 9.0 / 40},
+		{44.0 / 45, -56.0 / 15, 32.0 / 9},
+		{19372.0 / 6561, -25360.0 / 2187, 64448.0 / 6561, -212.0 / 729},
+		{9017.0 / 3168, -355.0 / 33, 46732.0 / 5247, 49.0 / 176, -5103.0 / 18656},
+		{35.0 / 384, 0, 500.0 / 1113, 125.0 / 192, -2187.0 / 6784, 11.0 / 84},
+	}
+	dpB = [7]float64{35.0 / 384, 0, 500.0 / 1113, 125.0 / 192, -2187.0 / 6784, 11.0 / 84, 0}
+	dpE = [7]float64{71.0 / 57600, 0, -71.0 / 16695, 71.0 / 1920, -17253.0 / 339200, 22.0 / 525, -1.0 / 40}
+)
+
+// ODE integrates the net as mass-action ordinary differential equations from the initial marking up to the horizon
+func ODE(net *PetriNet, horizon float64, opts ...func(*Solver)) Series {
+	s := Solver{AbsTol: 1e-6, RelTol: 1e-6, MaxSteps: 100000}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	labels := placeLabels(net)
+	txns := []*Transition{}
+	for _, label := range SortedKeys(net.Transitions) {
+		// substitution transitions only fire in the flattened net
+		if t := net.Transitions[label]; !t.IsSubstitution() {
+			txns = append(txns, t)
+		}
+	}
+	in := inputs(net, txns)
+	x := make([]float64, len(labels))
+	for i, v := range net.InitialVector() {
+		x[i] = float64(v)
+	}
+	series := Series{Values: map[string][]float64{}}
+	sample := func(t float64) {
+		series.Time = append(series.Time, t)
+		for i, label := range labels {
+			series.Values[label] = append(series.Values[label], x[i])
+		}
+	}
+	sample(0)
+
+	h := s.Step
+	if h <= 0 {
+		h = horizon / 100
+	}
+	t := 0.0
+	var k [7][]float64
+	for steps := 0; t < horizon && steps < s.MaxSteps; steps++ {
+		h = math.Min(h, horizon-t)
+		k[0] = derivative(x, txns, in)
+		for stage := 1; stage < 7; stage++ {
+			y := make([]float64, len(x))
+			for i := range x {
+				y[i] = x[i]
+				for j := 0; j < stage; j++ {
+					y[i] += h * dpA[stage][j] * k[j][i]
+				}
+			}
+			k[stage] = derivative(y, txns, in)
+		}
+		next := make([]float64, len(x))
+		errNorm := 0.0
+		for i := range x {
+			next[i] = x[i]
+			e := 0.0
+			for j := 0; j < 7; j++ {
+				next[i] += h * dpB[j] * k[j][i]
+				e += h * dpE[j] * k[j][i]
+			}
+			scale := s.AbsTol + s.RelTol*math.Max(math.Abs(x[i]), math.Abs(next[i]))
+			errNorm = math.Max(errNorm, math.Abs(e)/scale)
+		}
+		if errNorm <= 1 {
+			t += h
+			x = next
+			sample(t)
+		}
+		// grow or shrink the step with the usual safety factor and bounds
+		factor := 5.0
+		if errNorm > 0 {
+			factor = math.Min(5, math.Max(0.2, 0.9*math.Pow(errNorm, -0.2)))
+		}
+		h *= factor
+	}
+	series.Complete = t >= horizon
+	return series
+}
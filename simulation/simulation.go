@@ -0,0 +1,139 @@
+package simulation
+
+import (
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"github.com/pflow-xyz/go-metamodel/vasm"
+	"math/rand"
+)
+
+// Policy chooses one of the enabled actions, actions are given in label order
+type Policy func(enabled []string, state Vector) string
+
+// Uniform picks any enabled action with equal probability
+func Uniform(seed int64) Policy {
+	r := rand.New(rand.NewSource(seed))
+	return func(enabled []string, _ Vector) string {
+		return enabled[r.Intn(len(enabled))]
+	}
+}
+
+// Priority picks the first enabled action in order, unlisted actions come last in label order
+func Priority(order ...string) Policy {
+	rank := map[string]int{}
+	for i, action := range order {
+		rank[action] = i + 1
+	}
+	return func(enabled []string, _ Vector) string {
+		best := enabled[0]
+		for _, action := range enabled[1:] {
+			if rank[action] != 0 && (rank[best] == 0 || rank[action] < rank[best]) {
+				best = action
+			}
+		}
+		return best
+	}
+}
+
+// Weighted picks enabled actions proportionally to their weight, unlisted actions weigh 1
+func Weighted(seed int64, weights map[string]float64) Policy {
+	r := rand.New(rand.NewSource(seed))
+	return func(enabled []string, _ Vector) string {
+		total := 0.0
+		for _, action := range enabled {
+			total += weight(weights, action)
+		}
+		if total <= 0 {
+			return enabled[r.Intn(len(enabled))]
+		}
+		x := r.Float64() * total
+		for _, action := range enabled {
+			x -= weight(weights, action)
+			if x < 0 {
+				return action
+			}
+		}
+		return enabled[len(enabled)-1]
+	}
+}
+
+func weight(weights map[string]float64, action string) float64 {
+	w, ok := weights[action]
+	if !ok {
+		return 1
+	}
+	return w
+}
+
+// PlaceStats summarises the token count of a place over every visited marking
+type PlaceStats struct {
+	Min  int64   `json:"min"`
+	Max  int64   `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// Trace is the outcome of a simulation
+type Trace struct {
+	Events   []Event                `json:"events"`
+	State    Vector                 `json:"state"`
+	Deadlock bool                   `json:"deadlock"`
+	Stats    map[string]*PlaceStats `json:"stats"`
+}
+
+// Run fires up to steps enabled transitions chosen by the policy, stopping early on deadlock
+func Run(net *PetriNet, steps int, policy Policy, initialVec ...Vector) Trace {
+	j := vasm.Record(net, initialVec...)
+	labels := placeLabels(net)
+	trace := Trace{Stats: map[string]*PlaceStats{}}
+	state := j.GetState()
+	for i, label := range labels {
+		trace.Stats[label] = &PlaceStats{Min: state[i], Max: state[i]}
+	}
+	sums := make([]float64, len(state))
+	observe := func(s Vector) {
+		for i, v := range s {
+			st := trace.Stats[labels[i]]
+			if v < st.Min {
+				st.Min = v
+			}
+			if v > st.Max {
+				st.Max = v
+			}
+			sums[i] += float64(v)
+		}
+	}
+	observe(state)
+	visited := 1
+	for step := 0; step < steps; step++ {
+		enabled := []string{}
+		_, _, list := j.Enabled("")
+		for _, e := range list {
+			if e.Enabled {
+				enabled = append(enabled, e.Action)
+			}
+		}
+		if len(enabled) == 0 {
+			trace.Deadlock = true
+			break
+		}
+		ok, _, out := j.Fire(Op{Action: policy(enabled, j.GetState()), Multiple: 1})
+		if !ok {
+			continue
+		}
+		observe(out)
+		visited++
+	}
+	for i, label := range labels {
+		trace.Stats[label].Mean = sums[i] / float64(visited)
+	}
+	trace.Events = j.Events()
+	trace.State = j.GetState()
+	return trace
+}
+
+func placeLabels(net *PetriNet) []string {
+	labels := make([]string, len(net.Places))
+	for label, p := range net.Places {
+		labels[p.Offset] = label
+	}
+	return labels
+}
@@ -0,0 +1,169 @@
+package simulation_test
+
+import (
+	"github.com/pflow-xyz/go-metamodel/metamodel"
+	"github.com/pflow-xyz/go-metamodel/simulation"
+	"math"
+	"testing"
+)
+
+func queueDeclaration(m metamodel.Declaration) {
+	cell, fn := m.Cell, m.Fn
+	idle := cell().Label("idle").Initial(2)
+	busy := cell().Label("busy")
+	done := cell().Label("done").Capacity(5)
+	start := fn().Label("start")
+	finish := fn().Label("finish")
+	idle.Tx(1, start)
+	start.Tx(1, busy)
+	busy.Tx(1, finish)
+	finish.Tx(1, idle)
+	finish.Tx(1, done)
+}
+
+func TestRun(t *testing.T) {
+	mm := metamodel.New().Define(queueDeclaration)
+	trace := simulation.Run(mm.Net(), 100, simulation.Uniform(42))
+	if !trace.Deadlock {
+		t.Fatalf("expected done capacity to deadlock the queue")
+	}
+	if trace.Stats["done"].Max != 5 || trace.Stats["busy"].Max > 2 || trace.State[2] != 5 {
+		t.Fatalf("unexpected stats %v", trace.Stats["done"])
+	}
+	again := simulation.Run(mm.Net(), 100, simulation.Uniform(42))
+	if len(again.Events) != len(trace.Events) {
+		t.Fatalf("expected seeded runs to repeat")
+	}
+	for i, e := range trace.Events {
+		if again.Events[i].Action != e.Action {
+			t.Fatalf("expected seeded runs to repeat")
+		}
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	mm := metamodel.New().Define(queueDeclaration)
+	trace := simulation.Run(mm.Net(), 4, simulation.Priority("start"))
+	actions := []string{}
+	for _, e := range trace.Events {
+		actions = append(actions, e.Action)
+	}
+	if len(actions) != 4 || actions[0] != "start" || actions[1] != "start" || actions[2] != "finish" {
+		t.Fatalf("unexpected priority trace %v", actions)
+	}
+	trace = simulation.Run(mm.Net(), 3, simulation.Weighted(1, map[string]float64{"start": 0}))
+	if trace.Events[0].Action != "start" || trace.Events[1].Action != "finish" {
+		t.Fatalf("expected zero weighted start to fire only when nothing else is enabled")
+	}
+	if trace.Stats["idle"].Mean <= 0 {
+		t.Fatalf("expected mean occupancy")
+	}
+}
+
+func mm1Declaration(m metamodel.Declaration) {
+	cell, fn := m.Cell, m.Fn
+	queue := cell().Label("queue").Capacity(100)
+	arrive := fn().Label("arrive").Rate(2)
+	serve := fn().Label("serve").Rate(4)
+	arrive.Tx(1, queue)
+	queue.Tx(1, serve)
+}
+
+func TestGillespie(t *testing.T) {
+	mm := metamodel.New().Define(mm1Declaration)
+	trace := simulation.Gillespie(mm.Net(), 5000, 7)
+	if trace.Deadlock || math.Abs(trace.Time-5000) > 1e-9 {
+		t.Fatalf("expected run to reach the horizon")
+	}
+	if r := trace.Throughput["arrive"]; r < 1.8 || r > 2.2 {
+		t.Fatalf("expected arrival throughput near 2, got %v", r)
+	}
+	if q := trace.Occupancy["queue"]; q < 0.8 || q > 1.2 {
+		t.Fatalf("expected mean queue length near 1, got %v", q)
+	}
+	for i := 1; i < len(trace.Events); i++ {
+		if trace.Events[i].Time < trace.Events[i-1].Time {
+			t.Fatalf("expected ordered timestamps")
+		}
+	}
+
+	mm = metamodel.New().Define(queueDeclaration)
+	trace = simulation.Gillespie(mm.Net(), 1000, 7)
+	if !trace.Deadlock || trace.State[2] != 5 || len(trace.Events) != 12 {
+		t.Fatalf("expected done capacity to deadlock the queue")
+	}
+}
+
+func decayDeclaration(m metamodel.Declaration) {
+	cell, fn := m.Cell, m.Fn
+	a := cell().Label("a").Initial(100)
+	b := cell().Label("b")
+	decay := fn().Label("decay").Rate(0.5)
+	a.Tx(1, decay)
+	decay.Tx(1, b)
+}
+
+func TestODE(t *testing.T) {
+	mm := metamodel.New().Define(decayDeclaration)
+	series := simulation.ODE(mm.Net(), 4)
+	if !series.Complete || series.Time[len(series.Time)-1] != 4 {
+		t.Fatalf("expected integration to reach the horizon")
+	}
+	expected := 100 * math.Exp(-2)
+	if a := series.At("a", 4); math.Abs(a-expected) > 1e-3 {
+		t.Fatalf("expected %v tokens, got %v", expected, a)
+	}
+	for i := range series.Time {
+		if sum := series.Values["a"][i] + series.Values["b"][i]; math.Abs(sum-100) > 1e-6 {
+			t.Fatalf("expected tokens to be conserved, got %v", sum)
+		}
+	}
+
+	// second order: a consumes two tokens so it decays like 1/t rather than exponentially
+	mm = metamodel.New().Define(func(m metamodel.Declaration) {
+		a := m.Cell().Label("a").Initial(10)
+		pair := m.Fn().Label("pair")
+		a.Tx(2, pair)
+	})
+	series = simulation.ODE(mm.Net(), 1, simulation.Tolerance(1e-9, 1e-9))
+	if a := series.At("a", 1); math.Abs(a-10.0/21) > 1e-6 {
+		t.Fatalf("expected %v tokens, got %v", 10.0/21, a)
+	}
+	if a := series.At("a", -1); a != 10 {
+		t.Fatalf("expected times before the start to clamp to the initial count, got %v", a)
+	}
+
+	// a catalyst read or consumed and restored still scales the flux
+	for _, read := range []bool{true, false} {
+		mm = metamodel.New().Define(func(m metamodel.Declaration) {
+			a := m.Cell().Label("a").Initial(100)
+			b := m.Cell().Label("b")
+			enzyme := m.Cell().Label("enzyme").Initial(2)
+			convert := m.Fn().Label("convert").Rate(0.25)
+			a.Tx(1, convert)
+			convert.Tx(1, b)
+			if read {
+				convert.Guard(1, enzyme)
+			} else {
+				enzyme.Tx(1, convert)
+				convert.Tx(1, enzyme)
+			}
+		})
+		series = simulation.ODE(mm.Net(), 4)
+		if a := series.At("a", 4); math.Abs(a-expected) > 1e-3 {
+			t.Fatalf("expected %v tokens with read %v, got %v", expected, read, a)
+		}
+	}
+
+	approval := metamodel.New().Define(decayDeclaration).Net()
+	mm = metamodel.New().Define(func(m metamodel.Declaration) {
+		in := m.Cell().Label("in").Initial(10)
+		out := m.Cell().Label("out")
+		nested := m.Fn().Label("nested").Subnet("decay", approval, map[string]string{"a": "in", "b": "out"})
+		in.Tx(1, nested)
+		nested.Tx(1, out)
+	})
+	if in := simulation.ODE(mm.Net(), 1).At("in", 1); in != 10 {
+		t.Fatalf("expected substitution transition not to flow, got %v", in)
+	}
+}
@@ -0,0 +1,109 @@
+package simulation
+
+import (
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"github.com/pflow-xyz/go-metamodel/vasm"
+	"math"
+	"math/rand"
+)
+
+// TimedEvent is an event stamped with the simulated time it occurred
+type TimedEvent struct {
+	Time float64 `json:"time"`
+	Event
+}
+
+// StochasticTrace is the outcome of a continuous time simulation
+type StochasticTrace struct {
+	Events     []TimedEvent       `json:"events"`
+	State      Vector             `json:"state"`
+	Time       float64            `json:"time"`
+	Deadlock   bool               `json:"deadlock"`
+	Occupancy  map[string]float64 `json:"occupancy"`  // time weighted mean tokens per place
+	Throughput map[string]float64 `json:"throughput"` // fires per unit of time per transition
+}
+
+// rate applies the default of 1 to transitions that leave Rate unset, 0 cannot disable a reaction
+func rate(t *Transition) float64 {
+	if t.Rate == 0 {
+		return 1
+	}
+	return t.Rate
+}
+
+// Gillespie simulates a stochastic Petri net until the time horizon, a deadlocked marking is held until the horizon
+// each enabled transition fires after an exponential delay given by its Rate
+func Gillespie(net *PetriNet, horizon float64, seed int64, initialVec ...Vector) StochasticTrace {
+	r := rand.New(rand.NewSource(seed))
+	j := vasm.Record(net, initialVec...)
+	labels := placeLabels(net)
+	trace := StochasticTrace{
+		Events:     []TimedEvent{},
+		Occupancy:  map[string]float64{},
+		Throughput: map[string]float64{},
+	}
+	area := make([]float64, len(labels))
+	fired := map[string]int{}
+	times := []float64{}
+	now := 0.0
+	for now < horizon {
+		state := j.GetState()
+		enabled := []Enablement{}
+		total := 0.0
+		_, _, list := j.Enabled("")
+		for _, e := range list {
+			if e.Enabled {
+				enabled = append(enabled, e)
+				total += rate(net.Transitions[e.Action])
+			}
+		}
+		dt := horizon - now
+		if total > 0 {
+			dt = math.Min(dt, r.ExpFloat64()/total)
+		}
+		for i, v := range state {
+			area[i] += float64(v) * dt
+		}
+		now += dt
+		if len(enabled) == 0 {
+			trace.Deadlock = true
+			break
+		}
+		if now >= horizon {
+			break
+		}
+		x := r.Float64() * total
+		action := enabled[len(enabled)-1].Action
+		for _, e := range enabled {
+			x -= rate(net.Transitions[e.Action])
+			if x < 0 {
+				action = e.Action
+				break
+			}
+		}
+		if ok, _, _ := j.Fire(Op{Action: action, Multiple: 1}); ok {
+			fired[action]++
+			times = append(times, now)
+		}
+	}
+	for i, e := range j.Events() {
+		trace.Events = append(trace.Events, TimedEvent{Time: times[i], Event: e})
+	}
+	trace.Time = now
+	trace.State = j.GetState()
+	for i, label := range labels {
+		if now > 0 {
+			trace.Occupancy[label] = area[i] / now
+		} else {
+			trace.Occupancy[label] = float64(trace.State[i])
+		}
+	}
+	for label := range net.Transitions {
+		if now > 0 {
+			trace.Throughput[label] = float64(fired[label]) / now
+		} else {
+			trace.Throughput[label] = 0
+		}
+	}
+	return trace
+}
@@ -0,0 +1,120 @@
+package vasm
+
+import (
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"sort"
+)
+
+// Authorizer decides if an op may fire a transition
+// when rejecting it returns the roles that would have been accepted
+type Authorizer interface {
+	Authorize(txn *Transition, op Op) (ok bool, required []string)
+}
+
+// SetAuthorizer replaces the default RoleAssertion
+func (sm *StateMachine) SetAuthorizer(a Authorizer) *StateMachine {
+	sm.auth = a
+	return sm
+}
+
+// authorize rejects with FailedRoleAssertion, Enabled reports the roles that would have been accepted as its Label
+func (sm *StateMachine) authorize(txn *Transition, op Op) (ok bool, msg string) {
+	if ok, _ := sm.auth.Authorize(txn, op); !ok {
+		return false, FailedRoleAssertion
+	}
+	return true, OK
+}
+
+// roles collects roles asserted by an op from its principal or its role field
+func roles(op Op) []string {
+	if op.Principal != nil && len(op.Principal.Roles) > 0 {
+		return op.Principal.Roles
+	}
+	if op.Role != "" {
+		return []string{op.Role}
+	}
+	return nil
+}
+
+// RoleAssertion is the default authorizer, an op without a role is allowed
+// otherwise one of its roles must match the transition role
+type RoleAssertion struct{}
+
+func (RoleAssertion) Authorize(txn *Transition, op Op) (ok bool, required []string) {
+	asserted := roles(op)
+	if len(asserted) == 0 {
+		return true, nil
+	}
+	for _, r := range asserted {
+		if r == txn.Role.Label {
+			return true, nil
+		}
+	}
+	return false, []string{txn.Role.Label}
+}
+
+// Policy grants transitions to several roles and lets roles inherit the permissions of others
+type Policy struct {
+	DenyByDefault bool // reject ops that assert no role instead of allowing them
+	parents       map[string][]string
+	grants        map[string][]string
+}
+
+var _ Authorizer = &Policy{}
+
+func NewPolicy() *Policy {
+	return &Policy{
+		parents: map[string][]string{},
+		grants:  map[string][]string{},
+	}
+}
+
+// Deny rejects ops that assert no role
+func (p *Policy) Deny() *Policy {
+	p.DenyByDefault = true
+	return p
+}
+
+// Inherit gives a role every permission held by the parent roles
+func (p *Policy) Inherit(role string, parents ...string) *Policy {
+	p.parents[role] = append(p.parents[role], parents...)
+	return p
+}
+
+// Grant allows additional roles to fire a transition besides its declared role
+func (p *Policy) Grant(action string, roles ...string) *Policy {
+	p.grants[action] = append(p.grants[action], roles...)
+	return p
+}
+
+// expand returns the roles held directly or through inheritance
+func (p *Policy) expand(roles []string) map[string]bool {
+	held := map[string]bool{}
+	pending := append([]string{}, roles...)
+	for len(pending) > 0 {
+		r := pending[0]
+		pending = pending[1:]
+		if held[r] {
+			continue
+		}
+		held[r] = true
+		pending = append(pending, p.parents[r]...)
+	}
+	return held
+}
+
+func (p *Policy) Authorize(txn *Transition, op Op) (ok bool, required []string) {
+	required = append([]string{txn.Role.Label}, p.grants[txn.Label]...)
+	sort.Strings(required)
+	asserted := roles(op)
+	if len(asserted) == 0 {
+		return !p.DenyByDefault, required
+	}
+	held := p.expand(asserted)
+	for _, r := range required {
+		if held[r] {
+			return true, nil
+		}
+	}
+	return false, required
+}
@@ -0,0 +1,80 @@
+package vasm
+
+import (
+	"fmt"
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+)
+
+// FireAll applies ops in order against a scratch copy of the state and commits only if every op succeeds
+// results stop at the first failing op
+func (sm *StateMachine) FireAll(ops []Op) (ok bool, results []Result, out Vector) {
+	scratch := &StateMachine{
+		m:        sm.m,
+		state:    sm.GetState(),
+		capacity: sm.capacity,
+		auth:     sm.auth,
+		hooks:    hooks{before: sm.hooks.before},
+	}
+	return sm.fireAll(ops, scratch.Fire, func() {
+		copy(sm.state, scratch.state)
+	})
+}
+
+// fireAll runs ops through fire until one fails, on success commit applies the scratch state and fire hooks run
+func (sm *StateMachine) fireAll(ops []Op, fire func(Op) (bool, string, Vector), commit func()) (ok bool, results []Result, out Vector) {
+	results = []Result{}
+	pre := sm.GetState()
+	for _, op := range ops {
+		ok, msg, state := fire(op)
+		results = append(results, Result{Op: op, Ok: ok, Msg: msg, State: state})
+		if !ok {
+			sm.notify(sm.hooks.reject, op, pre, state, msg)
+			return false, results, sm.GetState()
+		}
+		pre = state
+	}
+	pre = sm.GetState()
+	commit()
+	for _, r := range results {
+		sm.notify(sm.hooks.fire, r.Op, pre, r.State, r.Msg)
+		pre = r.State
+	}
+	return true, results, sm.GetState()
+}
+
+// FireAll commits a batch and appends an event for each op
+func (j *Journal) FireAll(ops []Op) (ok bool, results []Result, out Vector) {
+	ok, results, out = j.StateMachine.FireAll(ops)
+	if ok {
+		for _, r := range results {
+			j.events = append(j.events, Event{
+				Seq:   int64(len(j.events) + 1),
+				State: r.State,
+				Op:    r.Op,
+			})
+		}
+	}
+	return ok, results, out
+}
+
+// FireAll commits a batch atomically with respect to other callers, processes without batches report Unsupported
+func (sp *SharedProcess) FireAll(ops []Op) (ok bool, results []Result, out Vector) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	p, supported := sp.p.(interface {
+		FireAll([]Op) (bool, []Result, Vector)
+	})
+	if !supported {
+		// report the batch as failing at its first op like any other rejection
+		r := Result{Msg: fmt.Sprintf(Unsupported, "FireAll"), State: sp.p.GetState()}
+		if len(ops) > 0 {
+			r.Op = ops[0]
+		}
+		return false, []Result{r}, sp.p.GetState()
+	}
+	ok, results, out = p.FireAll(ops)
+	if ok {
+		sp.seq += int64(len(results))
+	}
+	return ok, results, out
+}
@@ -0,0 +1,446 @@
+package vasm
+
+import (
+	"fmt"
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"reflect"
+)
+
+// Token is a coloured token, a record whose fields are described by the colour set of its place
+type Token = map[string]interface{}
+
+// ColourSet maps the fields of a record to their kind
+type ColourSet map[string]reflect.Kind
+
+// Binding maps arc variables to the tokens they carry while a transition fires
+type Binding map[string]Token
+
+// Expression computes the tokens a transition puts into an output place
+type Expression func(b Binding) []Token
+
+// ColouredProcess runs a net whose places hold records
+// token counts follow the embedded StateMachine which keeps checking capacity, guards, roles and hooks,
+// every method changing the state is overridden so records move together with the counts
+type ColouredProcess struct {
+	*StateMachine
+	sets        map[string]ColourSet
+	tokens      map[string][]Token
+	guards      map[string]func(Binding) bool
+	expressions map[[2]string]Expression
+}
+
+type selection struct {
+	binding  Binding
+	taken    map[string][]int
+	produced map[string][]Token
+}
+
+// NewColouredProcess runs a net with the given colour sets
+// plain places start with their initial count of empty tokens, coloured places start empty and are filled with Put
+func NewColouredProcess(m *PetriNet, sets map[string]ColourSet) *ColouredProcess {
+	c := &ColouredProcess{
+		sets:        sets,
+		tokens:      map[string][]Token{},
+		guards:      map[string]func(Binding) bool{},
+		expressions: map[[2]string]Expression{},
+	}
+	initial := m.InitialVector()
+	for label, p := range m.Places {
+		if p.ColourSet != "" {
+			if _, ok := sets[p.ColourSet]; !ok {
+				panic(fmt.Sprintf(UnknownColourSet, p.ColourSet))
+			}
+			initial[p.Offset] = 0
+		}
+		c.tokens[label] = []Token{}
+		for i := int64(0); i < initial[p.Offset]; i++ {
+			c.tokens[label] = append(c.tokens[label], Token{})
+		}
+	}
+	c.StateMachine = NewStateMachine(m, initial)
+	return c
+}
+
+// Guard registers a predicate a binding must satisfy for the action to fire
+func (c *ColouredProcess) Guard(action string, predicate func(Binding) bool) *ColouredProcess {
+	c.guards[action] = predicate
+	return c
+}
+
+// Expression registers how an action computes the tokens for an output place
+// without one an output arc produces the token bound to its variable or an empty token
+func (c *ColouredProcess) Expression(action string, place string, e Expression) *ColouredProcess {
+	c.expressions[[2]string{action, place}] = e
+	return c
+}
+
+// Put adds tokens to a place, checking them against its colour set and capacity
+func (c *ColouredProcess) Put(label string, tokens ...Token) (ok bool, msg string) {
+	p := c.m.Places[label]
+	if p == nil {
+		return false, ExpectedPlace
+	}
+	for _, t := range tokens {
+		if !c.matches(p, t) {
+			return false, fmt.Sprintf(BadToken, p.ColourSet)
+		}
+	}
+	if p.Capacity > 0 && c.state[p.Offset]+int64(len(tokens)) > p.Capacity {
+		return false, Overflow
+	}
+	c.tokens[label] = append(c.tokens[label], tokens...)
+	c.state[p.Offset] += int64(len(tokens))
+	return true, OK
+}
+
+// Tokens returns the records held by a place, oldest first
+func (c *ColouredProcess) Tokens(label string) []Token {
+	if c.m.Places[label] == nil {
+		panic(ExpectedPlace)
+	}
+	out := make([]Token, len(c.tokens[label]))
+	copy(out, c.tokens[label])
+	return out
+}
+
+func (c *ColouredProcess) matches(p *Place, t Token) bool {
+	if p.ColourSet == "" {
+		return true
+	}
+	set := c.sets[p.ColourSet]
+	if len(t) != len(set) {
+		return false
+	}
+	for field, kind := range set {
+		v, ok := t[field]
+		if !ok || v == nil || reflect.TypeOf(v).Kind() != kind {
+			return false
+		}
+	}
+	return true
+}
+
+// Bindings lists every binding that lets the action fire in the current state
+func (c *ColouredProcess) Bindings(action string) []Binding {
+	txn := c.m.Transitions[action]
+	if txn == nil {
+		panic(UnknownAction)
+	}
+	out := []Binding{}
+	op := Op{Action: action}
+	if ok, _ := c.veto(op); !ok {
+		return out
+	}
+	if ok, _, _ := c.testFire(op); !ok {
+		return out
+	}
+	c.search(txn, nil, func(b Binding, _ map[string][]int) bool {
+		sel := &selection{binding: Binding{}, produced: map[string][]Token{}}
+		for k, v := range b {
+			sel.binding[k] = v
+		}
+		if c.produce(txn, sel) == OK {
+			out = append(out, sel.binding)
+		}
+		return false
+	})
+	return out
+}
+
+// search visits selections of input tokens in oldest first order until visit returns true
+// bound arcs sharing a variable must select equal tokens, want restricts variables to given tokens
+func (c *ColouredProcess) search(txn *Transition, want Binding, visit func(Binding, map[string][]int) bool) bool {
+	inputs := []Arc{}
+	for _, a := range c.m.Arcs {
+		if !a.Inhibitor && a.Source.IsPlace() && a.Target.GetTransition() == txn {
+			inputs = append(inputs, a)
+		}
+	}
+	b := Binding{}
+	used := map[string]map[int]bool{}
+	taken := map[string][]int{}
+	guard := c.guards[txn.Label]
+	var next func(i int) bool
+	next = func(i int) bool {
+		if i == len(inputs) {
+			if guard != nil && !guard(b) {
+				return false
+			}
+			return visit(b, taken)
+		}
+		a := inputs[i]
+		label := a.Source.GetPlace().Label
+		if used[label] == nil {
+			used[label] = map[int]bool{}
+		}
+		if a.Bind == "" {
+			picked := []int{}
+			for idx := range c.tokens[label] {
+				if int64(len(picked)) == a.Weight {
+					break
+				}
+				if !used[label][idx] {
+					picked = append(picked, idx)
+				}
+			}
+			if int64(len(picked)) < a.Weight {
+				return false
+			}
+			for _, idx := range picked {
+				used[label][idx] = true
+			}
+			taken[label] = append(taken[label], picked...)
+			found := next(i + 1)
+			taken[label] = taken[label][:len(taken[label])-len(picked)]
+			for _, idx := range picked {
+				delete(used[label], idx)
+			}
+			return found
+		}
+		for idx, t := range c.tokens[label] {
+			if used[label][idx] {
+				continue
+			}
+			if w, ok := want[a.Bind]; ok && !reflect.DeepEqual(w, t) {
+				continue
+			}
+			prior, bound := b[a.Bind]
+			if bound && !reflect.DeepEqual(prior, t) {
+				continue
+			}
+			b[a.Bind] = t
+			used[label][idx] = true
+			taken[label] = append(taken[label], idx)
+			found := next(i + 1)
+			taken[label] = taken[label][:len(taken[label])-1]
+			delete(used[label], idx)
+			if !bound {
+				delete(b, a.Bind)
+			}
+			if found {
+				return true
+			}
+		}
+		return false
+	}
+	return next(0)
+}
+
+// test checks counts like StateMachine.TestFire then selects a binding and computes the output tokens
+func (c *ColouredProcess) test(op Op, want Binding) (ok bool, msg string, out Vector, sel *selection) {
+	if ok, msg = c.veto(op); !ok {
+		return false, msg, c.GetState(), nil
+	}
+	if ok, msg, out = c.testFire(op); !ok {
+		return false, msg, out, nil
+	}
+	if op.Multiple > 1 {
+		return false, BadMultiple, c.GetState(), nil
+	}
+	if sel, msg = c.bind(op, want); sel == nil {
+		return false, msg, c.GetState(), nil
+	}
+	return true, OK, out, sel
+}
+
+// bind selects the first binding of the action satisfying its guard whose output tokens can be computed
+// it accepts exactly the bindings listed by Bindings
+func (c *ColouredProcess) bind(op Op, want Binding) (sel *selection, msg string) {
+	txn := c.m.Transitions[op.Action]
+	msg = fmt.Sprintf(NoBinding, op.Action)
+	c.search(txn, want, func(b Binding, taken map[string][]int) bool {
+		s := &selection{binding: Binding{}, taken: map[string][]int{}, produced: map[string][]Token{}}
+		for k, v := range b {
+			s.binding[k] = v
+		}
+		for k, v := range taken {
+			s.taken[k] = append([]int{}, v...)
+		}
+		if failed := c.produce(txn, s); failed != OK {
+			msg = failed // kept as the reason when no later binding produces valid tokens
+			return false
+		}
+		sel = s
+		return true
+	})
+	return sel, msg
+}
+
+// produce fills the selection with output tokens checked against the colour set of each place
+func (c *ColouredProcess) produce(txn *Transition, s *selection) string {
+	for _, a := range c.m.Arcs {
+		if a.Inhibitor || !a.Source.IsTransition() || a.Source.GetTransition() != txn {
+			continue
+		}
+		p := a.Target.GetPlace()
+		weight := a.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		var tokens []Token
+		if e := c.expressions[[2]string{txn.Label, p.Label}]; e != nil {
+			tokens = e(s.binding)
+		} else if a.Bind != "" {
+			if t, ok := s.binding[a.Bind]; ok {
+				for i := int64(0); i < weight; i++ {
+					tokens = append(tokens, t)
+				}
+			}
+		} else {
+			for i := int64(0); i < weight; i++ {
+				tokens = append(tokens, Token{})
+			}
+		}
+		if int64(len(tokens)) != weight {
+			return fmt.Sprintf(BadExpression, p.Label, len(tokens), weight)
+		}
+		for _, t := range tokens {
+			if !c.matches(p, t) {
+				return fmt.Sprintf(BadToken, p.ColourSet)
+			}
+		}
+		s.produced[p.Label] = append(s.produced[p.Label], tokens...)
+	}
+	return OK
+}
+
+// TestFire checks that an op can fire with some binding without changing the state
+func (c *ColouredProcess) TestFire(op Op) (ok bool, msg string, out Vector) {
+	ok, msg, out, _ = c.test(op, nil)
+	c.notify(c.hooks.testFire, op, c.state, out, msg)
+	return ok, msg, out
+}
+
+// Fire consumes the oldest tokens satisfying the guard of the action
+func (c *ColouredProcess) Fire(op Op) (ok bool, msg string, out Vector) {
+	return c.fire(op, nil)
+}
+
+// FireBinding fires an action consuming tokens equal to the given variables
+func (c *ColouredProcess) FireBinding(op Op, b Binding) (ok bool, msg string, out Vector) {
+	return c.fire(op, b)
+}
+
+func (c *ColouredProcess) fire(op Op, want Binding) (ok bool, msg string, out Vector) {
+	ok, msg, out, sel := c.test(op, want)
+	if !ok {
+		c.notify(c.hooks.reject, op, c.state, out, msg)
+		return ok, msg, out
+	}
+	pre := c.GetState()
+	c.take(sel)
+	c.put(sel)
+	c.settle(out)
+	c.notify(c.hooks.fire, op, pre, out, msg)
+	return ok, msg, out
+}
+
+// take removes the input tokens of a selection
+func (c *ColouredProcess) take(sel *selection) {
+	for label, idxs := range sel.taken {
+		drop := map[int]bool{}
+		for _, idx := range idxs {
+			drop[idx] = true
+		}
+		kept := []Token{}
+		for idx, t := range c.tokens[label] {
+			if !drop[idx] {
+				kept = append(kept, t)
+			}
+		}
+		c.tokens[label] = kept
+	}
+}
+
+// put appends the output tokens of a selection
+func (c *ColouredProcess) put(sel *selection) {
+	for label, tokens := range sel.produced {
+		c.tokens[label] = append(c.tokens[label], tokens...)
+	}
+}
+
+// settle applies the counts computed by the state machine and trims records to match them
+func (c *ColouredProcess) settle(out Vector) {
+	for label, p := range c.m.Places {
+		c.state[p.Offset] = out[p.Offset]
+		if extra := int64(len(c.tokens[label])) - out[p.Offset]; extra > 0 {
+			// reentry into a safe place keeps a single token, the newest record wins
+			c.tokens[label] = c.tokens[label][extra:]
+		}
+	}
+}
+
+// scratch copies the process so ops can be tried without touching its state or records
+func (c *ColouredProcess) scratch() *ColouredProcess {
+	s := *c
+	s.StateMachine = &StateMachine{
+		m:        c.m,
+		state:    c.GetState(),
+		capacity: c.capacity,
+		auth:     c.auth,
+		hooks:    hooks{before: c.hooks.before},
+	}
+	s.tokens = map[string][]Token{}
+	for label, tokens := range c.tokens {
+		s.tokens[label] = append([]Token{}, tokens...)
+	}
+	return &s
+}
+
+// FireAll fires ops in order with their bindings, records and counts change only if every op succeeds
+func (c *ColouredProcess) FireAll(ops []Op) (ok bool, results []Result, out Vector) {
+	s := c.scratch()
+	return c.fireAll(ops, s.Fire, func() {
+		copy(c.state, s.state)
+		c.tokens = s.tokens
+	})
+}
+
+// step checks the counts of a step then binds each op to records not taken by the ops before it
+// records produced by the step are not available to its own ops
+func (c *ColouredProcess) step(ops []Op) (ok bool, msg string, out Vector, s *ColouredProcess, selections []*selection) {
+	if ok, msg, out = c.testStep(ops); !ok {
+		return false, msg, out, nil, nil
+	}
+	s = c.scratch()
+	for _, op := range ops {
+		if op.Multiple > 1 {
+			return false, BadMultiple, c.GetState(), nil, nil
+		}
+		sel, msg := s.bind(op, nil)
+		if sel == nil {
+			return false, msg, c.GetState(), nil, nil
+		}
+		s.take(sel)
+		selections = append(selections, sel)
+	}
+	return true, OK, out, s, selections
+}
+
+// TestStep checks that ops can fire simultaneously with disjoint bindings
+func (c *ColouredProcess) TestStep(ops []Op) (ok bool, msg string, out Vector) {
+	ok, msg, out, _, _ = c.step(ops)
+	for _, op := range ops {
+		c.notify(c.hooks.testFire, op, c.state, out, msg)
+	}
+	return ok, msg, out
+}
+
+// FireStep fires ops simultaneously, each consuming its own records
+func (c *ColouredProcess) FireStep(ops []Op) (ok bool, msg string, out Vector) {
+	pre := c.GetState()
+	ok, msg, out, s, selections := c.step(ops)
+	hs := c.hooks.reject
+	if ok {
+		c.tokens = s.tokens
+		for _, sel := range selections {
+			c.put(sel)
+		}
+		c.settle(out)
+		hs = c.hooks.fire
+	}
+	for _, op := range ops {
+		c.notify(hs, op, pre, out, msg)
+	}
+	return ok, msg, out
+}
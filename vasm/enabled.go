@@ -0,0 +1,84 @@
+package vasm
+
+import (
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"strings"
+)
+
+// Enabled reports every transition in label order, transitions the role is not authorised for are blocked
+// with the default RoleAssertion an empty role matches every transition like Op.Role
+// it returns ok like SharedProcess.Enabled, a state machine can always list its transitions
+func (sm *StateMachine) Enabled(role string) (ok bool, msg string, out []Enablement) {
+	labels := SortedKeys(sm.m.Transitions)
+	out = make([]Enablement, len(labels))
+	for i, label := range labels {
+		out[i] = sm.enablement(label, role)
+	}
+	return true, OK, out
+}
+
+func (sm *StateMachine) enablement(action string, role string) Enablement {
+	txn := sm.m.Transitions[action]
+	e := Enablement{Action: action}
+	if ok, msg := sm.veto(Op{Action: action, Role: role}); !ok {
+		e.Reason = msg
+		return e
+	}
+	if txn.IsSubstitution() {
+		e.Reason = substitutionUnsupported
+		return e
+	}
+	if ok, required := sm.auth.Authorize(txn, Op{Action: action, Role: role}); !ok {
+		e.Reason, e.Label = FailedRoleAssertion, strings.Join(required, ",")
+		return e
+	}
+	if inhibited, label := sm.Inhibited(Op{Action: action}); inhibited {
+		e.Reason, e.Label = Inhibited, label
+		return e
+	}
+	places := make([]string, len(sm.state))
+	for label, p := range sm.m.Places {
+		places[p.Offset] = label
+	}
+	if sm.isSafe() {
+		ok, msg, _, offset := sm.safeAdd(txn, 1)
+		if !ok {
+			e.Reason = msg
+			if offset >= 0 {
+				e.Label = places[offset]
+			}
+			return e
+		}
+		e.Enabled, e.Multiple, e.Reason = true, 1, msg
+		return e
+	}
+	e.Multiple = Unbounded
+	for i, d := range txn.Delta {
+		var k int64
+		if d < 0 {
+			k = sm.state[i] / -d
+		} else if d > 0 && sm.capacity[i] > 0 {
+			k = (sm.capacity[i] - sm.state[i]) / d
+		} else {
+			continue
+		}
+		if k < 0 {
+			k = 0
+		}
+		if e.Multiple == Unbounded || k < e.Multiple {
+			e.Multiple = k
+			if k == 0 {
+				e.Label = places[i]
+				e.Reason = Overflow
+				if d < 0 {
+					e.Reason = Underflow
+				}
+			}
+		}
+	}
+	if e.Multiple == 0 {
+		return e
+	}
+	e.Enabled, e.Reason = true, OK
+	return e
+}
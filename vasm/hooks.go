@@ -0,0 +1,62 @@
+package vasm
+
+import (
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+)
+
+// Hook observes an op with the state before and after it applies and the result message
+// hooks run synchronously, under the lock when the state machine is shared
+type Hook func(op Op, pre Vector, post Vector, msg string)
+
+// Veto runs before an op is tested, returning false rejects the op with msg
+type Veto func(op Op, pre Vector) (ok bool, msg string)
+
+type hooks struct {
+	before   []Veto
+	testFire []Hook
+	fire     []Hook
+	reject   []Hook
+}
+
+// Before registers a veto that runs before every TestFire and Fire
+func (sm *StateMachine) Before(v Veto) *StateMachine {
+	sm.hooks.before = append(sm.hooks.before, v)
+	return sm
+}
+
+// OnTestFire registers a hook called after every TestFire
+func (sm *StateMachine) OnTestFire(h Hook) *StateMachine {
+	sm.hooks.testFire = append(sm.hooks.testFire, h)
+	return sm
+}
+
+// OnFire registers a hook called after an op changes the state
+func (sm *StateMachine) OnFire(h Hook) *StateMachine {
+	sm.hooks.fire = append(sm.hooks.fire, h)
+	return sm
+}
+
+// OnReject registers a hook called when Fire refuses an op
+func (sm *StateMachine) OnReject(h Hook) *StateMachine {
+	sm.hooks.reject = append(sm.hooks.reject, h)
+	return sm
+}
+
+func (sm *StateMachine) veto(op Op) (ok bool, msg string) {
+	for _, v := range sm.hooks.before {
+		if ok, msg = v(op, sm.GetState()); !ok {
+			return false, msg
+		}
+	}
+	return true, OK
+}
+
+func (sm *StateMachine) notify(hs []Hook, op Op, pre Vector, post Vector, msg string) {
+	for _, h := range hs {
+		p := make(Vector, len(pre))
+		copy(p, pre)
+		out := make(Vector, len(post))
+		copy(out, post)
+		h(op, p, out, msg)
+	}
+}
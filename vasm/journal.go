@@ -0,0 +1,106 @@
+package vasm
+
+import (
+	"fmt"
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+)
+
+// Journal is a state machine that appends an Event for every successful fire
+type Journal struct {
+	*StateMachine
+	initial Vector
+	events  []Event
+}
+
+var _ History = &Journal{}
+
+// Record runs a net like Execute while keeping an event log
+func Record(m *PetriNet, initialVec ...Vector) *Journal {
+	sm := NewStateMachine(m, initialVec...)
+	return &Journal{
+		StateMachine: sm,
+		initial:      sm.GetState(),
+		events:       []Event{},
+	}
+}
+
+// Replay rebuilds a journal by firing each event against the net and asserting the recorded state
+func Replay(m *PetriNet, events []Event, initialVec ...Vector) (j *Journal, ok bool, msg string) {
+	j = Record(m, initialVec...)
+	for i := 0; i < len(events); {
+		e := events[i]
+		ok, msg, out := false, "", Vector{}
+		if e.Step == 0 {
+			ok, msg, out = j.Fire(e.Op)
+			i++
+		} else {
+			ops := []Op{}
+			for ; i < len(events) && events[i].Step == e.Step; i++ {
+				ops = append(ops, events[i].Op)
+			}
+			e = events[i-1]
+			ok, msg, out = j.FireStep(ops)
+		}
+		if !ok {
+			return j, false, msg
+		}
+		if !equal(out, e.State) {
+			return j, false, fmt.Sprintf(ReplayMismatch, e.Seq)
+		}
+	}
+	return j, true, OK
+}
+
+func (j *Journal) Fire(op Op) (ok bool, msg string, out Vector) {
+	ok, msg, out = j.StateMachine.Fire(op)
+	if ok {
+		j.events = append(j.events, Event{
+			Seq:   int64(len(j.events) + 1),
+			State: j.GetState(),
+			Op:    op,
+		})
+	}
+	return ok, msg, out
+}
+
+// Events returns a copy of the log
+func (j *Journal) Events() []Event {
+	events := make([]Event, len(j.events))
+	copy(events, j.events)
+	return events
+}
+
+// Seq is the sequence number of the last event
+func (j *Journal) Seq() int64 {
+	return int64(len(j.events))
+}
+
+// Undo discards events after seq and restores the state recorded at that point
+func (j *Journal) Undo(seq int64) (ok bool, msg string, out Vector) {
+	if seq < 0 || seq > j.Seq() {
+		return false, fmt.Sprintf(BadSequence, seq), j.GetState()
+	}
+	if seq > 0 && seq < j.Seq() && j.events[seq].Step != 0 && j.events[seq].Step == j.events[seq-1].Step {
+		// cannot stop in the middle of a step
+		return false, fmt.Sprintf(BadSequence, seq), j.GetState()
+	}
+	state := j.initial
+	if seq > 0 {
+		state = j.events[seq-1].State
+	}
+	copy(j.state, state)
+	j.events = j.events[:seq]
+	return true, OK, j.GetState()
+}
+
+func equal(a Vector, b Vector) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if b[i] != v {
+			return false
+		}
+	}
+	return true
+}
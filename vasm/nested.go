@@ -0,0 +1,88 @@
+package vasm
+
+import . "github.com/pflow-xyz/go-metamodel/metamodel"
+
+// Nested runs a net with substitution transitions through its flattened form
+type Nested struct {
+	*StateMachine
+	root *PetriNet
+}
+
+// ExecuteNested flattens a hierarchical model and runs it, initial vectors follow the flattened offsets
+func ExecuteNested(m MetaModel, initialVec ...Vector) *Nested {
+	return &Nested{
+		StateMachine: NewStateMachine(m.Flatten().Net(), initialVec...),
+		root:         m.Net(),
+	}
+}
+
+// Scope returns a process addressing the subnet reached through the given substitution transitions
+// by its local labels, port places resolve to the places they are bound to
+func (n *Nested) Scope(path ...string) Process {
+	s := &scope{sm: n.StateMachine, net: n.root, resolve: func(label string) string { return label }}
+	for _, label := range path {
+		txn := s.net.Transitions[label]
+		if txn == nil || txn.SubnetNode == nil || txn.SubnetNode.PetriNet == nil {
+			panic(UnknownElement)
+		}
+		outer, ports, inner := s.resolve, txn.Ports, s.prefix+label+"."
+		s.resolve = func(l string) string {
+			if socket, ok := ports[l]; ok {
+				return outer(socket)
+			}
+			return inner + l
+		}
+		s.prefix = inner
+		s.net = txn.SubnetNode.PetriNet
+	}
+	return s
+}
+
+type scope struct {
+	sm      *StateMachine
+	net     *PetriNet
+	prefix  string
+	resolve func(string) string
+}
+
+func (s *scope) op(op Op) Op {
+	op.Action = s.prefix + op.Action
+	return op
+}
+
+// project maps a vector of the flattened net onto the offsets of the subnet
+func (s *scope) project(v Vector) Vector {
+	out := s.net.EmptyVector()
+	if len(v) != len(s.sm.state) {
+		return out
+	}
+	for label, p := range s.net.Places {
+		out[p.Offset] = v[s.sm.m.Places[s.resolve(label)].Offset]
+	}
+	return out
+}
+
+func (s *scope) GetState() Vector {
+	return s.project(s.sm.state)
+}
+
+func (s *scope) TokenCount(label string) int64 {
+	if s.net.Places[label] == nil {
+		panic(ExpectedPlace)
+	}
+	return s.sm.TokenCount(s.resolve(label))
+}
+
+func (s *scope) Inhibited(op Op) (bool, string) {
+	return s.sm.Inhibited(s.op(op))
+}
+
+func (s *scope) TestFire(op Op) (bool, string, Vector) {
+	ok, msg, out := s.sm.TestFire(s.op(op))
+	return ok, msg, s.project(out)
+}
+
+func (s *scope) Fire(op Op) (bool, string, Vector) {
+	ok, msg, out := s.sm.Fire(s.op(op))
+	return ok, msg, s.project(out)
+}
@@ -0,0 +1,104 @@
+package vasm
+
+import (
+	"fmt"
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"sync"
+)
+
+// SharedProcess serialises access to a process so concurrent callers cannot both spend the same tokens
+type SharedProcess struct {
+	mu  sync.RWMutex
+	p   Process
+	seq int64
+}
+
+var _ Process = &SharedProcess{}
+
+// Share runs a net like Execute behind a lock
+func Share(m *PetriNet, initialVec ...Vector) *SharedProcess {
+	return Synchronize(Execute(m, initialVec...))
+}
+
+// Synchronize wraps an existing process, callers must not use the wrapped process directly afterwards
+func Synchronize(p Process) *SharedProcess {
+	return &SharedProcess{p: p}
+}
+
+func (sp *SharedProcess) GetState() Vector {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.p.GetState()
+}
+
+func (sp *SharedProcess) TokenCount(label string) int64 {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.p.TokenCount(label)
+}
+
+func (sp *SharedProcess) Inhibited(op Op) (flag bool, label string) {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.p.Inhibited(op)
+}
+
+// TestFire takes the write lock because vetoes and OnTestFire hooks run under it
+func (sp *SharedProcess) TestFire(op Op) (flag bool, msg string, out Vector) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.p.TestFire(op)
+}
+
+// Fire tests and applies an op atomically
+func (sp *SharedProcess) Fire(op Op) (ok bool, msg string, out Vector) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.fire(op)
+}
+
+// FireAt fires only if no other fire has succeeded since the caller observed seq
+func (sp *SharedProcess) FireAt(seq int64, op Op) (ok bool, msg string, out Vector) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if seq != sp.seq {
+		return false, fmt.Sprintf(StaleSequence, seq, sp.seq), sp.p.GetState()
+	}
+	return sp.fire(op)
+}
+
+func (sp *SharedProcess) fire(op Op) (ok bool, msg string, out Vector) {
+	ok, msg, out = sp.p.Fire(op)
+	if ok {
+		sp.seq++
+	}
+	return ok, msg, out
+}
+
+// Enabled lists transitions of the wrapped process, processes that cannot list them report Unsupported
+// like TestFire it holds the write lock while vetoes run
+func (sp *SharedProcess) Enabled(role string) (ok bool, msg string, out []Enablement) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	p, supported := sp.p.(interface {
+		Enabled(string) (bool, string, []Enablement)
+	})
+	if !supported {
+		return false, fmt.Sprintf(Unsupported, "Enabled"), []Enablement{}
+	}
+	return p.Enabled(role)
+}
+
+// Snapshot returns the state together with the sequence number to pass to FireAt
+func (sp *SharedProcess) Snapshot() (seq int64, state Vector) {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.seq, sp.p.GetState()
+}
+
+// Seq counts successful fires
+func (sp *SharedProcess) Seq() int64 {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.seq
+}
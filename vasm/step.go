@@ -0,0 +1,154 @@
+package vasm
+
+import (
+	"fmt"
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+)
+
+// TestStep checks if a multiset of ops can fire simultaneously
+// the combined input demand must be covered by the current state, the combined output must respect capacity
+// and every guard is evaluated against the state before the step
+func (sm *StateMachine) TestStep(ops []Op) (flag bool, msg string, out Vector) {
+	flag, msg, out = sm.testStep(ops)
+	for _, op := range ops {
+		sm.notify(sm.hooks.testFire, op, sm.state, out, msg)
+	}
+	return flag, msg, out
+}
+
+func (sm *StateMachine) testStep(ops []Op) (flag bool, msg string, out Vector) {
+	demand := make(Vector, len(sm.state))
+	delta := make(Vector, len(sm.state))
+	for _, op := range ops {
+		txn := sm.m.Transitions[op.Action]
+		if txn == nil {
+			return false, UnknownAction, sm.GetState()
+		}
+		if txn.IsSubstitution() {
+			return false, substitutionUnsupported, sm.GetState()
+		}
+		if ok, msg := sm.veto(op); !ok {
+			return false, msg, sm.GetState()
+		}
+		if ok, msg := sm.authorize(txn, op); !ok {
+			return false, msg, sm.GetState()
+		}
+		if op.Multiple < 0 {
+			return false, BadMultiple, sm.GetState()
+		} else if op.Multiple == 0 {
+			op.Multiple = 1
+		}
+		if isInhibited, label := sm.Inhibited(op); isInhibited {
+			return false, fmt.Sprintf(InhibitedTransition, label), sm.GetState()
+		}
+		for i, d := range txn.Delta {
+			delta[i] += d * op.Multiple
+		}
+		for _, a := range sm.m.Arcs {
+			// demand comes from input arcs so tokens a transition consumes and restores are still required
+			if !a.Inhibitor && a.Source.IsPlace() && a.Target.GetTransition() == txn {
+				demand[a.Source.GetPlace().Offset] -= a.Weight * op.Multiple
+			}
+		}
+	}
+	if flag, msg, _ = Add(sm.state, demand, 1); !flag {
+		return false, msg, sm.GetState()
+	}
+	if sm.isSafe() {
+		return sm.safeStep(ops, delta)
+	}
+	flag, msg, out = Add(sm.state, delta, 1, sm.capacity)
+	if !flag {
+		return false, msg, out
+	}
+	return true, OK, out
+}
+
+// safeStep applies the combined delta with the safeAdd rules
+// a place marked twice stays marked only if every transition of the step producing into it allows reentry
+// places the step does not produce into are left as they are
+func (sm *StateMachine) safeStep(ops []Op, delta Vector) (ok bool, msg string, out Vector) {
+	out = make(Vector, len(sm.state))
+	for _, op := range ops {
+		if op.Multiple > 1 {
+			return false, BadMultiple, out
+		}
+	}
+	msg = OK
+	var total int64 = 0
+	for i, v := range sm.state {
+		out[i] = v + delta[i]
+		if out[i] > 1 {
+			writes := false
+			for _, op := range ops {
+				txn := sm.m.Transitions[op.Action]
+				if txn.Delta[i] > 0 {
+					if !txn.AllowReentry {
+						return false, ReentryDenied, out
+					}
+					writes = true
+				}
+			}
+			if writes {
+				out[i], msg = 1, Reentered
+			}
+		}
+		if sm.capacity[i] > 0 && out[i] > sm.capacity[i] {
+			return false, Overflow, out
+		}
+		total += out[i]
+	}
+	if sm.m.ModelType == ElementaryType && total > 1 {
+		return false, Overflow, out
+	}
+	return true, msg, out
+}
+
+// FireStep fires a multiset of ops simultaneously
+func (sm *StateMachine) FireStep(ops []Op) (ok bool, msg string, out Vector) {
+	pre := sm.GetState()
+	ok, msg, out = sm.testStep(ops)
+	hs := sm.hooks.reject
+	if ok {
+		copy(sm.state, out)
+		hs = sm.hooks.fire
+	}
+	for _, op := range ops {
+		sm.notify(hs, op, pre, out, msg)
+	}
+	return ok, msg, out
+}
+
+// FireStep fires ops simultaneously and appends an event for each op sharing the same step number
+func (j *Journal) FireStep(ops []Op) (ok bool, msg string, out Vector) {
+	ok, msg, out = j.StateMachine.FireStep(ops)
+	if ok {
+		step := j.Seq() + 1
+		for _, op := range ops {
+			j.events = append(j.events, Event{
+				Seq:   int64(len(j.events) + 1),
+				State: j.GetState(),
+				Op:    op,
+				Step:  step,
+			})
+		}
+	}
+	return ok, msg, out
+}
+
+// FireStep fires ops simultaneously with respect to other callers, processes without steps report Unsupported
+func (sp *SharedProcess) FireStep(ops []Op) (ok bool, msg string, out Vector) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	p, supported := sp.p.(interface {
+		FireStep([]Op) (bool, string, Vector)
+	})
+	if !supported {
+		return false, fmt.Sprintf(Unsupported, "FireStep"), sp.p.GetState()
+	}
+	ok, msg, out = p.FireStep(ops)
+	if ok {
+		sp.seq += int64(len(ops))
+	}
+	return ok, msg, out
+}
@@ -0,0 +1,196 @@
+package vasm
+
+import (
+	"fmt"
+	. "github.com/pflow-xyz/go-metamodel/metamodel"
+	"sort"
+)
+
+// TimedStateMachine runs a net under time Petri net semantics driven by a virtual clock
+// a transition may fire once it has been enabled for Earliest ticks and must fire before Latest ticks pass
+type TimedStateMachine struct {
+	*StateMachine
+	now       int64
+	since     map[string]int64 // clock value at which each enabled transition became enabled
+	scheduled []scheduledOp
+	clock     int // position of the ready veto among the before hooks
+}
+
+type scheduledOp struct {
+	at int64
+	op Op
+}
+
+// NewTimedStateMachine runs a net like NewStateMachine with the clock starting at zero
+func NewTimedStateMachine(m *PetriNet, initialVec ...Vector) *TimedStateMachine {
+	t := &TimedStateMachine{StateMachine: NewStateMachine(m, initialVec...), since: map[string]int64{}}
+	t.clock = len(t.hooks.before)
+	t.Before(t.ready)
+	t.OnFire(func(op Op, _ Vector, _ Vector, _ string) {
+		t.refresh(op.Action)
+	})
+	t.refresh("")
+	return t
+}
+
+// Now returns the current clock value
+func (t *TimedStateMachine) Now() int64 {
+	return t.now
+}
+
+// Elapsed returns how long an action has been enabled, 0 and false if it is not enabled
+func (t *TimedStateMachine) Elapsed(action string) (int64, bool) {
+	since, ok := t.since[action]
+	if !ok {
+		return 0, false
+	}
+	return t.now - since, true
+}
+
+// Enabled lists transitions like StateMachine.Enabled at the current time
+// a transition that has not been enabled for Earliest ticks is reported as TooEarly
+func (t *TimedStateMachine) Enabled(role string) (ok bool, msg string, out []Enablement) {
+	ok, msg, out = t.StateMachine.Enabled(role)
+	for i, e := range out {
+		if !e.Enabled {
+			continue
+		}
+		if ready, reason := t.ready(Op{Action: e.Action}, nil); !ready {
+			out[i].Enabled, out[i].Multiple, out[i].Reason = false, 0, reason
+		}
+	}
+	return ok, msg, out
+}
+
+// ready vetoes ops whose transition has not been enabled long enough
+func (t *TimedStateMachine) ready(op Op, _ Vector) (ok bool, msg string) {
+	txn := t.m.Transitions[op.Action]
+	since, enabled := t.since[op.Action]
+	if txn == nil || !enabled {
+		return true, OK // left for testFire to report
+	}
+	if at := since + txn.Earliest; t.now < at {
+		return false, fmt.Sprintf(TooEarly, op.Action, at)
+	}
+	return true, OK
+}
+
+// enabled tests a transition against the current state ignoring roles, vetoes and the clock
+// substitution transitions never fire so their clock never starts
+func (t *TimedStateMachine) enabled(txn *Transition) bool {
+	if txn.IsSubstitution() {
+		return false
+	}
+	if inhibited, _ := t.Inhibited(Op{Action: txn.Label}); inhibited {
+		return false
+	}
+	if t.isSafe() {
+		ok, _, _, _ := t.safeAdd(txn, 1)
+		return ok
+	}
+	ok, _, _ := Add(t.state, txn.Delta, 1, t.capacity)
+	return ok
+}
+
+// refresh starts the clock of newly enabled transitions and of the transition that just fired
+func (t *TimedStateMachine) refresh(fired string) {
+	for label, txn := range t.m.Transitions {
+		if !t.enabled(txn) {
+			delete(t.since, label)
+		} else if _, ok := t.since[label]; !ok || label == fired {
+			t.since[label] = t.now
+		}
+	}
+}
+
+// FireAll applies ops in order at the current time against a scratch clock
+// so each op must be ready given the transitions enabled or reset by the ops before it
+func (t *TimedStateMachine) FireAll(ops []Op) (ok bool, results []Result, out Vector) {
+	scratch := &TimedStateMachine{
+		StateMachine: &StateMachine{m: t.m, state: t.GetState(), capacity: t.capacity, auth: t.auth},
+		now:          t.now,
+		since:        map[string]int64{},
+	}
+	for label, since := range t.since {
+		scratch.since[label] = since
+	}
+	// the caller vetoes are kept in place and the clock veto is swapped for the one reading the scratch clock
+	scratch.hooks.before = append([]Veto{}, t.hooks.before...)
+	scratch.hooks.before[t.clock] = scratch.ready
+	scratch.OnFire(func(op Op, _ Vector, _ Vector, _ string) {
+		scratch.refresh(op.Action)
+	})
+	return t.fireAll(ops, scratch.Fire, func() {
+		copy(t.state, scratch.state)
+		t.since = scratch.since
+	})
+}
+
+// Next returns the enabled action that can fire soonest and the time it becomes ready
+func (t *TimedStateMachine) Next() (action string, at int64, ok bool) {
+	for _, label := range SortedKeys(t.since) {
+		ready := t.since[label] + t.m.Transitions[label].Earliest
+		if ready < t.now {
+			ready = t.now
+		}
+		if !ok || ready < at {
+			action, at, ok = label, ready, true
+		}
+	}
+	return action, at, ok
+}
+
+// Deadline returns the enabled action that must fire soonest and the time it is due
+func (t *TimedStateMachine) Deadline() (action string, at int64, ok bool) {
+	for _, label := range SortedKeys(t.since) {
+		txn := t.m.Transitions[label]
+		if txn.Latest == 0 {
+			continue
+		}
+		if due := t.since[label] + txn.Latest; !ok || due < at {
+			action, at, ok = label, due, true
+		}
+	}
+	return action, at, ok
+}
+
+// Schedule queues an op to fire when the clock reaches at
+func (t *TimedStateMachine) Schedule(op Op, at int64) (ok bool, msg string) {
+	if at < t.now {
+		return false, fmt.Sprintf(BadSchedule, at, t.now)
+	}
+	i := sort.Search(len(t.scheduled), func(i int) bool {
+		return t.scheduled[i].at > at
+	})
+	t.scheduled = append(t.scheduled, scheduledOp{})
+	copy(t.scheduled[i+1:], t.scheduled[i:])
+	t.scheduled[i] = scheduledOp{at: at, op: op}
+	return true, OK
+}
+
+// Advance moves the clock forward firing scheduled ops as their time comes
+// the clock cannot pass the deadline of an enabled transition, in that case it stops at the deadline
+// and returns false so the overdue transition can be fired before advancing again
+func (t *TimedStateMachine) Advance(ticks int64) (ok bool, msg string, results []Result) {
+	if ticks < 0 {
+		return false, fmt.Sprintf(BadSchedule, t.now+ticks, t.now), results
+	}
+	target := t.now + ticks
+	for {
+		action, due, hasDeadline := t.Deadline()
+		if len(t.scheduled) > 0 && t.scheduled[0].at <= target && (!hasDeadline || t.scheduled[0].at <= due) {
+			next := t.scheduled[0]
+			t.scheduled = t.scheduled[1:]
+			t.now = next.at
+			ok, msg, out := t.Fire(next.op)
+			results = append(results, Result{Op: next.op, Ok: ok, Msg: msg, State: out})
+			continue
+		}
+		if hasDeadline && due < target {
+			t.now = due
+			return false, fmt.Sprintf(Overdue, action, due), results
+		}
+		t.now = target
+		return true, OK, results
+	}
+}
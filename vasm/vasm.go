@@ -7,15 +7,30 @@ type StateMachine struct {
 	m        *PetriNet
 	state    Vector
 	capacity Vector
+	auth     Authorizer
+	hooks    hooks
 }
 
 func (sm *StateMachine) TestFire(op Op) (flag bool, msg string, out Vector) {
+	if flag, msg = sm.veto(op); flag {
+		flag, msg, out = sm.testFire(op)
+	} else {
+		out = sm.GetState()
+	}
+	sm.notify(sm.hooks.testFire, op, sm.state, out, msg)
+	return flag, msg, out
+}
+
+func (sm *StateMachine) testFire(op Op) (flag bool, msg string, out Vector) {
 	txn := sm.m.Transitions[op.Action]
 	if txn == nil {
 		return false, UnknownAction, sm.GetState()
 	}
-	if op.Role != "" && txn.Role.Label != op.Role {
-		return false, FailedRoleAssertion, sm.GetState()
+	if txn.IsSubstitution() {
+		return false, substitutionUnsupported, sm.GetState()
+	}
+	if ok, msg := sm.authorize(txn, op); !ok {
+		return false, msg, sm.GetState()
 	}
 	if op.Multiple < 0 {
 		return false, BadMultiple, sm.GetState()
@@ -26,21 +41,71 @@ func (sm *StateMachine) TestFire(op Op) (flag bool, msg string, out Vector) {
 	if isInhibited {
 		return false, fmt.Sprintf(InhibitedTransition, label), out
 	}
-	flag, msg, out = Add(sm.state, txn.Delta, op.Multiple, sm.capacity)
+	if sm.isSafe() {
+		flag, msg, out, _ = sm.safeAdd(txn, op.Multiple)
+	} else {
+		flag, msg, out = Add(sm.state, txn.Delta, op.Multiple, sm.capacity)
+	}
 	if !flag {
 		return false, msg, out
 	}
-	return true, OK, out // REVIEW: match lua implementation to return Role
+	return true, msg, out // REVIEW: match lua implementation to return Role
 }
 
-func (sm *StateMachine) Fire(op Op) (ok bool, msg string, out Vector) {
-	// TODO: refactor to support wf-nets and elementary modelTypes
-	ok, msg, out = sm.TestFire(op)
-	if ok {
-		for i, v := range out {
-			sm.state[i] = v
+var substitutionUnsupported = fmt.Sprintf(Unsupported, "substitution transitions, run the flattened net")
+
+// isSafe is true for model types where a place holds at most one token
+func (sm *StateMachine) isSafe() bool {
+	return sm.m.ModelType == WorkflowType || sm.m.ModelType == ElementaryType
+}
+
+// safeAdd applies a transition under workflow and elementary semantics
+// a marked output place blocks the transition unless it allows reentry, in which case the place stays marked
+// and the result message is Reentered instead of OK, elementary nets additionally hold one token in total
+func (sm *StateMachine) safeAdd(txn *Transition, multiple int64) (ok bool, msg string, out Vector, offset int) {
+	out = make([]int64, len(sm.state))
+	if multiple != 1 {
+		return false, BadMultiple, out, -1
+	}
+	msg = OK
+	var total int64 = 0
+	for i, v := range sm.state {
+		out[i] = v + txn.Delta[i]
+		if out[i] < 0 {
+			return false, Underflow, out, i
 		}
+		if txn.Delta[i] > 0 && out[i] > 1 {
+			if !txn.AllowReentry {
+				return false, ReentryDenied, out, i
+			}
+			out[i], msg = 1, Reentered
+		}
+		if sm.capacity[i] > 0 && out[i] > sm.capacity[i] {
+			return false, Overflow, out, i
+		}
+		total += out[i]
+	}
+	if sm.m.ModelType == ElementaryType && total > 1 {
+		return false, Overflow, out, -1
+	}
+	return true, msg, out, -1
+}
+
+func (sm *StateMachine) Fire(op Op) (ok bool, msg string, out Vector) {
+	if ok, msg = sm.veto(op); ok {
+		ok, msg, out = sm.testFire(op)
+	} else {
+		out = sm.GetState()
+	}
+	if !ok {
+		sm.notify(sm.hooks.reject, op, sm.state, out, msg)
+		return ok, msg, out
 	}
+	pre := sm.GetState()
+	for i, v := range out {
+		sm.state[i] = v
+	}
+	sm.notify(sm.hooks.fire, op, pre, out, msg)
 	return ok, msg, out
 }
 
@@ -80,9 +145,14 @@ func (sm *StateMachine) TokenCount(label string) int64 {
 
 // Execute run the m
 func Execute(m *PetriNet, initialVec ...Vector) Process {
+	return NewStateMachine(m, initialVec...)
+}
 
+// NewStateMachine runs a net like Execute returning the concrete type so it can be configured
+func NewStateMachine(m *PetriNet, initialVec ...Vector) *StateMachine {
 	sm := new(StateMachine)
 	sm.m = m
+	sm.auth = RoleAssertion{}
 	switch len(initialVec) {
 	case 0:
 		sm.state = m.InitialVector()
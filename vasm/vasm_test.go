@@ -0,0 +1,631 @@
+package vasm_test
+
+import (
+	"fmt"
+	"github.com/pflow-xyz/go-metamodel/metamodel"
+	"github.com/pflow-xyz/go-metamodel/vasm"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func counterDeclaration(m metamodel.Declaration) {
+	cell, fn := m.Cell, m.Fn
+
+	source := cell().Label("source").Initial(3).Capacity(3)
+	sink := cell().Label("sink").Capacity(2)
+	move := fn().Label("move")
+	back := fn().Label("back").Role("admin")
+
+	source.Tx(1, move)
+	move.Tx(1, sink)
+	sink.Tx(1, back)
+	back.Tx(1, source)
+}
+
+func fire(t *testing.T, p metamodel.Process, action string, expectOk bool) metamodel.Vector {
+	ok, msg, out := p.Fire(metamodel.Op{Action: action})
+	if ok != expectOk {
+		t.Fatalf("fire %s expected %v got %v: %s", action, expectOk, ok, msg)
+	}
+	return out
+}
+
+func TestJournal(t *testing.T) {
+	mm := metamodel.New().Define(counterDeclaration)
+	j := vasm.Record(mm.Net())
+	fire(t, j, "move", true)
+	fire(t, j, "move", true)
+	fire(t, j, "move", false)
+	if j.Seq() != 2 {
+		t.Fatalf("expected 2 events got %v", j.Events())
+	}
+
+	replayed, ok, msg := vasm.Replay(mm.Net(), j.Events())
+	if !ok || replayed.TokenCount("sink") != 2 {
+		t.Fatalf("replay failed: %s", msg)
+	}
+
+	if ok, _, out := j.Undo(1); !ok || out[mm.Net().Places["sink"].Offset] != 1 {
+		t.Fatalf("undo failed %v", out)
+	}
+	if ok, _, out := j.Undo(0); !ok || j.TokenCount("source") != 3 || len(j.Events()) != 0 {
+		t.Fatalf("undo to start failed %v", out)
+	}
+	if ok, _, _ := j.Undo(5); ok {
+		t.Fatalf("expected undo past end to fail")
+	}
+
+	tampered := replayed.Events()
+	tampered[1].State = metamodel.Vector{9, 9}
+	if _, ok, _ := vasm.Replay(mm.Net(), tampered); ok {
+		t.Fatalf("expected replay mismatch")
+	}
+}
+
+func TestSharedProcess(t *testing.T) {
+	mm := metamodel.New().Define(counterDeclaration)
+	p := vasm.Share(mm.Net())
+
+	var wg sync.WaitGroup
+	var fired int64
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _, _ := p.Fire(metamodel.Op{Action: "move"}); ok {
+				atomic.AddInt64(&fired, 1)
+			}
+			p.GetState()
+		}()
+	}
+	wg.Wait()
+	if fired != 2 || p.TokenCount("sink") != 2 || p.TokenCount("source") != 1 {
+		t.Fatalf("tokens over-spent: fired %v state %v", fired, p.GetState())
+	}
+
+	seq, _ := p.Snapshot()
+	var won int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _, _ := p.FireAt(seq, metamodel.Op{Action: "back"}); ok {
+				atomic.AddInt64(&won, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 || p.Seq() != seq+1 {
+		t.Fatalf("expected exactly one optimistic fire got %v", won)
+	}
+}
+
+// counter is a minimal Process without the optional batch, step and enablement methods
+type counter struct{}
+
+func (counter) GetState() metamodel.Vector            { return metamodel.Vector{0} }
+func (counter) TokenCount(string) int64               { return 0 }
+func (counter) Inhibited(metamodel.Op) (bool, string) { return false, "" }
+func (counter) TestFire(metamodel.Op) (bool, string, metamodel.Vector) {
+	return false, metamodel.Underflow, metamodel.Vector{0}
+}
+func (counter) Fire(op metamodel.Op) (bool, string, metamodel.Vector) {
+	return counter{}.TestFire(op)
+}
+
+func TestEnabled(t *testing.T) {
+	mm := metamodel.New().Define(counterDeclaration)
+	p := vasm.Share(mm.Net())
+	_, _, enabled := p.Enabled("")
+	if len(enabled) != 2 {
+		t.Fatalf("expected 2 transitions got %v", enabled)
+	}
+	back, move := enabled[0], enabled[1]
+	if back.Enabled || back.Reason != metamodel.Overflow || back.Label != "source" {
+		t.Fatalf("expected back to overflow source got %v", back)
+	}
+	if !move.Enabled || move.Multiple != 2 {
+		t.Fatalf("expected move to fire twice got %v", move)
+	}
+	if ok, _, _ := p.TestFire(metamodel.Op{Action: "move", Multiple: move.Multiple}); !ok {
+		t.Fatalf("expected maximal multiple to pass")
+	}
+	if ok, _, _ := p.TestFire(metamodel.Op{Action: "move", Multiple: move.Multiple + 1}); ok {
+		t.Fatalf("expected larger multiple to fail")
+	}
+	p.Fire(metamodel.Op{Action: "move", Multiple: 2})
+	_, _, enabled = p.Enabled("default")
+	if enabled[0].Reason != metamodel.FailedRoleAssertion || enabled[0].Label != "admin" {
+		t.Fatalf("expected role assertion got %v", enabled[0])
+	}
+	if enabled[1].Enabled || enabled[1].Reason != metamodel.Overflow || enabled[1].Label != "sink" {
+		t.Fatalf("expected overflow got %v", enabled[1])
+	}
+	spawn := metamodel.New().Define(func(m metamodel.Declaration) {
+		pool := m.Cell().Label("pool")
+		m.Fn().Label("spawn").Tx(1, pool)
+	})
+	sm := vasm.NewStateMachine(spawn.Net())
+	if _, _, e := sm.Enabled(""); !e[0].Enabled || e[0].Multiple != metamodel.Unbounded {
+		t.Fatalf("expected unbounded multiple got %v", e[0])
+	}
+	sm.Before(func(op metamodel.Op, pre metamodel.Vector) (bool, string) { return false, "closed" })
+	if _, _, e := sm.Enabled(""); e[0].Enabled || e[0].Reason != "closed" {
+		t.Fatalf("expected veto to block spawn got %v", e[0])
+	}
+	if ok, msg, _ := vasm.Synchronize(counter{}).Enabled(""); ok || msg != fmt.Sprintf(metamodel.Unsupported, "Enabled") {
+		t.Fatalf("expected unsupported got %s", msg)
+	}
+	if ok, results, _ := vasm.Synchronize(counter{}).FireAll([]metamodel.Op{{Action: "move"}}); ok || results[0].Msg != fmt.Sprintf(metamodel.Unsupported, "FireAll") {
+		t.Fatalf("expected unsupported got %v", results)
+	}
+	if ok, msg, _ := vasm.Synchronize(counter{}).FireStep([]metamodel.Op{{Action: "move"}}); ok || msg != fmt.Sprintf(metamodel.Unsupported, "FireStep") {
+		t.Fatalf("expected unsupported got %s", msg)
+	}
+}
+
+func TestFireAll(t *testing.T) {
+	mm := metamodel.New().Define(counterDeclaration)
+	j := vasm.Record(mm.Net())
+	ok, results, out := j.FireAll([]metamodel.Op{{Action: "move"}, {Action: "move"}, {Action: "move"}})
+	if ok || len(results) != 3 || results[2].Msg != metamodel.Overflow {
+		t.Fatalf("expected third move to overflow got %v", results)
+	}
+	if out[0] != 3 || j.TokenCount("source") != 3 || j.Seq() != 0 {
+		t.Fatalf("expected nothing to be committed got %v", out)
+	}
+	ok, results, out = j.FireAll([]metamodel.Op{{Action: "move"}, {Action: "move"}, {Action: "back"}})
+	if !ok || len(results) != 3 || out[0] != 2 || out[1] != 1 {
+		t.Fatalf("expected batch to commit got %v %v", results, out)
+	}
+	if j.Seq() != 3 || j.Events()[1].State[1] != 2 {
+		t.Fatalf("expected an event per op got %v", j.Events())
+	}
+}
+
+func TestFireStep(t *testing.T) {
+	mm := metamodel.New().Define(func(m metamodel.Declaration) {
+		cell, fn := m.Cell, m.Fn
+		funds := cell().Label("funds").Initial(3)
+		settled := cell().Label("settled").Capacity(4)
+		lock := cell().Label("lock")
+		settle := fn().Label("settle")
+		close := fn().Label("close")
+		funds.Tx(1, settle)
+		settle.Tx(1, settled)
+		close.Tx(1, lock)
+		lock.Guard(1, settle)
+	})
+	j := vasm.Record(mm.Net())
+	if ok, msg, _ := j.FireStep([]metamodel.Op{{Action: "settle", Multiple: 2}, {Action: "settle", Multiple: 2}}); ok || msg != metamodel.Underflow {
+		t.Fatalf("expected combined demand to underflow got %s", msg)
+	}
+	// guards are evaluated before the step so close does not inhibit settle
+	ok, msg, out := j.FireStep([]metamodel.Op{{Action: "settle", Multiple: 2}, {Action: "close"}})
+	if !ok || out[1] != 2 || out[2] != 1 {
+		t.Fatalf("expected step to fire got %s %v", msg, out)
+	}
+	if ok, _, _ := j.Fire(metamodel.Op{Action: "settle"}); ok {
+		t.Fatalf("expected settle to be inhibited after the step")
+	}
+	if _, ok, msg := vasm.Replay(mm.Net(), j.Events()); !ok {
+		t.Fatalf("failed to replay step %s", msg)
+	}
+	if ok, _, _ := j.Undo(1); ok {
+		t.Fatalf("expected undo inside a step to fail")
+	}
+
+	shared := metamodel.New().Define(func(m metamodel.Declaration) {
+		cell, fn := m.Cell, m.Fn
+		token := cell().Label("token").Initial(1)
+		for _, label := range []string{"left", "right"} {
+			use := fn().Label(label)
+			token.Tx(1, use)
+			use.Tx(1, token)
+		}
+	})
+	sm := vasm.NewStateMachine(shared.Net())
+	tested := 0
+	sm.OnTestFire(func(op metamodel.Op, pre metamodel.Vector, post metamodel.Vector, msg string) {
+		tested++
+	})
+	if ok, msg, _ := sm.TestStep([]metamodel.Op{{Action: "left"}, {Action: "right"}}); ok || msg != metamodel.Underflow {
+		t.Fatalf("expected both self-loops to demand the token got %s", msg)
+	}
+	if tested != 2 {
+		t.Fatalf("expected a test hook per op got %v", tested)
+	}
+}
+
+func TestModelTypes(t *testing.T) {
+	declaration := func(m metamodel.Declaration) {
+		cell, fn := m.Cell, m.Fn
+		start := cell().Label("start").Initial(1)
+		review := cell().Label("review")
+		other := cell().Label("other")
+		submit := fn().Label("submit")
+		remind := fn().Label("remind")
+		nudge := fn(func(t *metamodel.Transition) { t.AllowReentry = true }).Label("nudge")
+		fork := fn().Label("fork")
+		start.Tx(1, submit)
+		submit.Tx(1, review)
+		remind.Tx(1, review)
+		nudge.Tx(1, review)
+		review.Tx(1, fork)
+		fork.Tx(1, start)
+		fork.Tx(1, other)
+	}
+
+	p := vasm.Execute(metamodel.New(metamodel.PetriNetType).Define(declaration).Net())
+	fire(t, p, "submit", true)
+	fire(t, p, "remind", true)
+	if p.TokenCount("review") != 2 {
+		t.Fatalf("expected petriNet places to accumulate tokens")
+	}
+
+	wf := metamodel.New(metamodel.WorkflowType).Define(declaration)
+	p = vasm.Execute(wf.Net())
+	if ok, _, _ := p.Fire(metamodel.Op{Action: "submit", Multiple: 2}); ok {
+		t.Fatalf("expected multiple to be rejected")
+	}
+	fire(t, p, "submit", true)
+	if ok, msg, _ := p.Fire(metamodel.Op{Action: "remind"}); ok || msg != metamodel.ReentryDenied {
+		t.Fatalf("expected reentry to be denied got %s", msg)
+	}
+	if ok, msg, _ := p.Fire(metamodel.Op{Action: "nudge"}); !ok || msg != metamodel.Reentered {
+		t.Fatalf("expected nudge to report the merged token got %s", msg)
+	}
+	if p.TokenCount("review") != 1 {
+		t.Fatalf("expected review to stay at one token")
+	}
+	// places the transition does not produce into are not checked for reentry
+	crowded := vasm.NewStateMachine(wf.Net(), metamodel.Vector{1, 0, 2})
+	if ok, msg, _ := crowded.TestFire(metamodel.Op{Action: "submit"}); !ok {
+		t.Fatalf("expected submit to ignore other got %s", msg)
+	}
+	sm := vasm.NewStateMachine(wf.Net(), p.GetState())
+	_, _, single := sm.TestFire(metamodel.Op{Action: "nudge"})
+	if ok, msg, out := sm.TestStep([]metamodel.Op{{Action: "nudge"}}); !ok || out[1] != single[1] {
+		t.Fatalf("expected step to allow reentry like TestFire got %s %v", msg, out)
+	}
+	if ok, msg, _ := sm.TestStep([]metamodel.Op{{Action: "nudge"}, {Action: "remind"}}); ok || msg != metamodel.ReentryDenied {
+		t.Fatalf("expected reentry to be denied got %s", msg)
+	}
+	fire(t, p, "fork", true)
+
+	el := metamodel.New(metamodel.ElementaryType).Define(declaration)
+	p = vasm.Execute(el.Net())
+	fire(t, p, "submit", true)
+	if ok, msg, _ := p.Fire(metamodel.Op{Action: "fork"}); ok || msg != metamodel.Overflow {
+		t.Fatalf("expected elementary net to hold one token got %s", msg)
+	}
+	for _, modelType := range []string{metamodel.WorkflowType, metamodel.ElementaryType} {
+		_, err := metamodel.New(modelType).DefineE(func(m metamodel.Declaration) {
+			m.Cell().Label("start").Initial(2)
+		})
+		if errs, ok := err.(metamodel.ValidationErrors); !ok || errs[0].Reason != metamodel.BadInitial {
+			t.Fatalf("expected %s to reject two initial tokens got %v", modelType, err)
+		}
+	}
+	_, err := metamodel.New(metamodel.ElementaryType).DefineE(func(m metamodel.Declaration) {
+		m.Cell().Label("a").Initial(1)
+		m.Cell().Label("b").Initial(1)
+	})
+	if errs, ok := err.(metamodel.ValidationErrors); !ok || errs[0].Reason != metamodel.BadInitial {
+		t.Fatalf("expected elementary net to reject two marked places got %v", err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	mm := metamodel.New().Define(counterDeclaration)
+	sm := vasm.NewStateMachine(mm.Net())
+	if ok, msg, _ := sm.TestFire(metamodel.Op{Action: "back", Role: "user"}); ok || msg != metamodel.FailedRoleAssertion {
+		t.Fatalf("expected role assertion message got %s", msg)
+	}
+
+	policy := vasm.NewPolicy().Deny().Inherit("owner", "admin").Grant("move", "clerk")
+	sm.SetAuthorizer(policy)
+	if ok, _, _ := sm.TestFire(metamodel.Op{Action: "move"}); ok {
+		t.Fatalf("expected op without role to be denied")
+	}
+	clerk := &metamodel.Principal{Id: "alice", Roles: []string{"clerk"}}
+	if ok, msg, _ := sm.Fire(metamodel.Op{Action: "move", Principal: clerk}); !ok {
+		t.Fatalf("expected clerk to be granted move: %s", msg)
+	}
+	if ok, msg, _ := sm.TestFire(metamodel.Op{Action: "back", Principal: clerk}); ok || msg != metamodel.FailedRoleAssertion {
+		t.Fatalf("expected clerk to be denied back got %s", msg)
+	}
+	owner := &metamodel.Principal{Id: "bob", Roles: []string{"owner"}}
+	if ok, msg, _ := sm.TestFire(metamodel.Op{Action: "back", Principal: owner}); !ok {
+		t.Fatalf("expected owner to inherit admin: %s", msg)
+	}
+	_, _, enabled := sm.Enabled("")
+	if enabled[1].Enabled || enabled[1].Reason != metamodel.FailedRoleAssertion || enabled[1].Label != "clerk,default" {
+		t.Fatalf("expected deny by default in enabled list got %v", enabled[1])
+	}
+}
+
+func TestHooks(t *testing.T) {
+	mm := metamodel.New().Define(counterDeclaration)
+	sm := vasm.NewStateMachine(mm.Net())
+	fired, rejected, tested := []string{}, []string{}, 0
+	sm.OnFire(func(op metamodel.Op, pre metamodel.Vector, post metamodel.Vector, msg string) {
+		if post[1] != pre[1]+1 {
+			t.Fatalf("unexpected transition %v -> %v", pre, post)
+		}
+		fired = append(fired, op.Action)
+	}).OnReject(func(op metamodel.Op, pre metamodel.Vector, post metamodel.Vector, msg string) {
+		rejected = append(rejected, msg)
+	}).OnTestFire(func(op metamodel.Op, pre metamodel.Vector, post metamodel.Vector, msg string) {
+		tested++
+	}).Before(func(op metamodel.Op, pre metamodel.Vector) (bool, string) {
+		if op.Role == "auditor" {
+			return false, "read only"
+		}
+		return true, metamodel.OK
+	})
+	j := vasm.Synchronize(sm)
+	j.TestFire(metamodel.Op{Action: "move"})
+	fire(t, j, "move", true)
+	if ok, msg, _ := j.Fire(metamodel.Op{Action: "move", Role: "auditor"}); ok || msg != "read only" {
+		t.Fatalf("expected veto got %s", msg)
+	}
+	j.FireAll([]metamodel.Op{{Action: "move"}, {Action: "move"}})
+	if tested != 1 || len(fired) != 1 || len(rejected) != 2 || rejected[1] != metamodel.Overflow {
+		t.Fatalf("unexpected hooks tested=%v fired=%v rejected=%v", tested, fired, rejected)
+	}
+}
+
+func slaDeclaration(m metamodel.Declaration) {
+	cell, fn := m.Cell, m.Fn
+
+	submitted := cell().Label("submitted").Initial(1)
+	approved := cell().Label("approved")
+	escalated := cell().Label("escalated")
+	approve := fn().Label("approve").Delay(2, 0)
+	escalate := fn().Label("escalate").Delay(48, 48)
+
+	submitted.Tx(1, approve)
+	approve.Tx(1, approved)
+	submitted.Tx(1, escalate)
+	escalate.Tx(1, escalated)
+}
+
+func TestTimedStateMachine(t *testing.T) {
+	mm := metamodel.New().Define(slaDeclaration)
+	tm := vasm.NewTimedStateMachine(mm.Net())
+	fire(t, tm, "escalate", false)
+	if _, _, enabled := tm.Enabled(""); enabled[0].Enabled || enabled[0].Reason != fmt.Sprintf(metamodel.TooEarly, "approve", 2) {
+		t.Fatalf("expected approve to be too early got %v", enabled[0])
+	}
+	if action, at, _ := tm.Next(); action != "approve" || at != 2 {
+		t.Fatalf("expected approve ready at 2 got %s at %v", action, at)
+	}
+	if action, at, _ := tm.Deadline(); action != "escalate" || at != 48 {
+		t.Fatalf("expected escalate due at 48 got %s at %v", action, at)
+	}
+	ok, msg, _ := tm.Advance(100)
+	if ok || tm.Now() != 48 {
+		t.Fatalf("expected clock to stop at the deadline got %v: %s", tm.Now(), msg)
+	}
+	fire(t, tm, "escalate", true)
+	if ok, _, _ := tm.Advance(52); !ok || tm.Now() != 100 || tm.TokenCount("escalated") != 1 {
+		t.Fatalf("expected escalation to complete")
+	}
+
+	tm = vasm.NewTimedStateMachine(mm.Net())
+	if ok, _ := tm.Schedule(metamodel.Op{Action: "approve"}, 1); !ok {
+		t.Fatalf("expected schedule")
+	}
+	tm.Schedule(metamodel.Op{Action: "approve"}, 10)
+	ok, _, results := tm.Advance(100)
+	if !ok || len(results) != 2 || results[0].Ok || !results[1].Ok || tm.TokenCount("approved") != 1 {
+		t.Fatalf("expected early approval to fail and the later one to succeed %v", results)
+	}
+	if elapsed, ok := tm.Elapsed("escalate"); ok || elapsed != 0 {
+		t.Fatalf("expected escalate to be disabled after approval got %v", elapsed)
+	}
+	if ok, _ := tm.Schedule(metamodel.Op{Action: "approve"}, 50); ok {
+		t.Fatalf("expected scheduling in the past to fail")
+	}
+
+	tm = vasm.NewTimedStateMachine(mm.Net())
+	if ok, msg, _ := tm.FireStep([]metamodel.Op{{Action: "escalate"}}); ok {
+		t.Fatalf("expected step to respect the clock: %s", msg)
+	}
+	queued := metamodel.New().Define(func(m metamodel.Declaration) {
+		idle := m.Cell().Label("idle").Initial(1)
+		submitted := m.Cell().Label("submitted")
+		escalated := m.Cell().Label("escalated")
+		start := m.Fn().Label("start")
+		escalate := m.Fn().Label("escalate").Delay(48, 0)
+		idle.Tx(1, start)
+		start.Tx(1, submitted)
+		submitted.Tx(1, escalate)
+		escalate.Tx(1, escalated)
+	})
+	tm = vasm.NewTimedStateMachine(queued.Net())
+	batch := []metamodel.Op{{Action: "start"}, {Action: "escalate"}}
+	if ok, results, _ := tm.FireAll(batch); ok || results[1].Msg != fmt.Sprintf(metamodel.TooEarly, "escalate", 48) {
+		t.Fatalf("expected batch to respect the clock got %v", results)
+	}
+	if ok, _, _ := tm.FireAll(batch[:1]); !ok {
+		t.Fatalf("expected start to fire")
+	}
+	tm.Advance(48)
+	if ok, results, _ := tm.FireAll(batch[1:]); !ok || tm.TokenCount("escalated") != 1 {
+		t.Fatalf("expected escalate to fire after 48 got %v", results)
+	}
+
+	_, err := metamodel.New().DefineE(func(m metamodel.Declaration) {
+		m.Fn().Label("late").Delay(5, 1)
+	})
+	if err == nil {
+		t.Fatalf("expected bad delay to fail")
+	}
+}
+
+func orderDeclaration(m metamodel.Declaration) {
+	cell, fn := m.Cell, m.Fn
+
+	orders := cell().Label("orders").Colour("order")
+	credit := cell().Label("credit").Colour("account")
+	approved := cell().Label("approved").Colour("order")
+	ledger := cell().Label("ledger").Colour("charge")
+	approve := fn().Label("approve")
+
+	orders.Bind("o", approve)
+	credit.Bind("a", approve)
+	approve.Bind("o", approved)
+	approve.Tx(1, ledger)
+}
+
+func TestColouredProcess(t *testing.T) {
+	mm := metamodel.New().Define(orderDeclaration)
+	url, _ := mm.ZipUrl()
+	m2 := metamodel.New()
+	if _, err := m2.UnpackFromUrlE(url); err != nil {
+		t.Fatalf("failed to unzip %v", err)
+	}
+	sets := map[string]vasm.ColourSet{
+		"order":   {"id": reflect.Int, "user": reflect.String},
+		"account": {"user": reflect.String},
+		"charge":  {"order": reflect.Int},
+	}
+	cp := vasm.NewColouredProcess(m2.Net(), sets)
+	cp.Guard("approve", func(b vasm.Binding) bool {
+		return b["o"]["user"] == b["a"]["user"]
+	}).Expression("approve", "ledger", func(b vasm.Binding) []vasm.Token {
+		return []vasm.Token{{"order": b["o"]["id"]}}
+	})
+	alice := vasm.Token{"id": 1, "user": "alice"}
+	bob := vasm.Token{"id": 2, "user": "bob"}
+	cp.Put("orders", alice, bob)
+	cp.Put("credit", vasm.Token{"user": "bob"})
+	if ok, _ := cp.Put("credit", vasm.Token{"user": 3}); ok {
+		t.Fatalf("expected mistyped token to be refused")
+	}
+	if b := cp.Bindings("approve"); len(b) != 1 || b[0]["o"]["id"] != 2 {
+		t.Fatalf("expected only bob to bind got %v", b)
+	}
+	fire(t, cp, "approve", true)
+	if approved := cp.Tokens("approved"); len(approved) != 1 || approved[0]["user"] != "bob" {
+		t.Fatalf("expected bob's order to be approved got %v", approved)
+	}
+	if ledger := cp.Tokens("ledger"); len(ledger) != 1 || ledger[0]["order"] != 2 || cp.TokenCount("orders") != 1 {
+		t.Fatalf("expected a charge for order 2 got %v", ledger)
+	}
+	fire(t, cp, "approve", false)
+
+	cp.Put("credit", vasm.Token{"user": "carol"}, vasm.Token{"user": "alice"})
+	if ok, msg, _ := cp.FireBinding(metamodel.Op{Action: "approve"}, vasm.Binding{"a": {"user": "carol"}}); ok {
+		t.Fatalf("expected carol to have no matching order: %s", msg)
+	}
+	if ok, msg, _ := cp.FireBinding(metamodel.Op{Action: "approve"}, vasm.Binding{"o": alice}); !ok {
+		t.Fatalf("expected alice to be approved: %s", msg)
+	}
+	if credit := cp.Tokens("credit"); len(credit) != 1 || credit[0]["user"] != "carol" || cp.TokenCount("approved") != 2 {
+		t.Fatalf("expected only carol's credit to remain got %v", credit)
+	}
+
+	newProcess := func(users ...string) *vasm.ColouredProcess {
+		cp := vasm.NewColouredProcess(m2.Net(), sets)
+		cp.Guard("approve", func(b vasm.Binding) bool {
+			return b["o"]["user"] == b["a"]["user"]
+		}).Expression("approve", "ledger", func(b vasm.Binding) []vasm.Token {
+			return []vasm.Token{{"order": b["o"]["id"]}}
+		})
+		cp.Put("orders", alice, bob)
+		for _, user := range users {
+			cp.Put("credit", vasm.Token{"user": user})
+		}
+		return cp
+	}
+	approve := []metamodel.Op{{Action: "approve"}, {Action: "approve"}}
+	cp = newProcess("alice", "bob")
+	if ok, results, _ := vasm.Synchronize(cp).FireAll(approve); !ok || len(cp.Tokens("approved")) != 2 || len(cp.Tokens("orders")) != 0 {
+		t.Fatalf("expected batch to move records got %v", results)
+	}
+	cp = newProcess("bob", "carol")
+	if ok, results, _ := cp.FireAll(approve); ok || len(cp.Tokens("orders")) != 2 || cp.TokenCount("orders") != 2 {
+		t.Fatalf("expected failed batch to keep records got %v", results)
+	}
+	if ok, msg, _ := cp.FireStep(approve); ok || msg != fmt.Sprintf(metamodel.NoBinding, "approve") {
+		t.Fatalf("expected step bindings to be disjoint got %s", msg)
+	}
+	cp = newProcess("alice", "bob")
+	if ok, msg, _ := cp.FireStep(approve); !ok || len(cp.Tokens("ledger")) != 2 || len(cp.Tokens("credit")) != 0 {
+		t.Fatalf("expected step to move records: %s", msg)
+	}
+
+	cp = newProcess("bob")
+	cp.SetAuthorizer(vasm.NewPolicy().Deny())
+	if b := cp.Bindings("approve"); len(b) != 0 {
+		t.Fatalf("expected no bindings for a disabled transition got %v", b)
+	}
+	cp = newProcess("alice", "bob")
+	cp.Expression("approve", "ledger", func(b vasm.Binding) []vasm.Token {
+		if b["o"]["user"] == "alice" {
+			return nil
+		}
+		return []vasm.Token{{"order": b["o"]["id"]}}
+	})
+	if b := cp.Bindings("approve"); len(b) != 1 || b[0]["o"]["user"] != "bob" {
+		t.Fatalf("expected bindings with failing expressions to be dropped got %v", b)
+	}
+	if ok, msg, _ := cp.Fire(metamodel.Op{Action: "approve"}); !ok || cp.Tokens("approved")[0]["user"] != "bob" {
+		t.Fatalf("expected fire to skip to the binding listed by Bindings: %s", msg)
+	}
+	if ok, msg, _ := cp.Fire(metamodel.Op{Action: "approve"}); ok || msg != fmt.Sprintf(metamodel.BadExpression, "ledger", 0, 1) {
+		t.Fatalf("expected the failing expression to be reported got %s", msg)
+	}
+	cp = newProcess("bob")
+	cp.Before(func(op metamodel.Op, pre metamodel.Vector) (bool, string) { return false, "closed" })
+	if b := cp.Bindings("approve"); len(b) != 0 {
+		t.Fatalf("expected vetoed transition to have no bindings got %v", b)
+	}
+}
+
+func TestNested(t *testing.T) {
+	approval := metamodel.New().Define(func(m metamodel.Declaration) {
+		in := m.Cell().Label("in")
+		pending := m.Cell().Label("pending")
+		out := m.Cell().Label("out")
+		take := m.Fn().Label("take")
+		finish := m.Fn().Label("finish")
+		in.Tx(1, take)
+		take.Tx(1, pending)
+		pending.Tx(1, finish)
+		finish.Tx(1, out)
+	}).Net()
+	mm := metamodel.New().Define(func(m metamodel.Declaration) {
+		start := m.Cell().Label("start").Initial(1)
+		done := m.Cell().Label("done")
+		review := m.Fn().Label("review").Subnet("approval", approval, map[string]string{"in": "start", "out": "done"})
+		start.Tx(1, review)
+		review.Tx(1, done)
+	})
+	fire(t, vasm.Execute(mm.Net()), "review", false)
+	if _, _, e := vasm.NewStateMachine(mm.Net()).Enabled(""); e[0].Enabled || e[0].Reason != fmt.Sprintf(metamodel.Unsupported, "substitution transitions, run the flattened net") {
+		t.Fatalf("expected substitution transition to be blocked got %v", e)
+	}
+	if ok, msg, _ := vasm.NewStateMachine(mm.Net()).FireStep([]metamodel.Op{{Action: "review"}}); ok || msg != fmt.Sprintf(metamodel.Unsupported, "substitution transitions, run the flattened net") {
+		t.Fatalf("expected step with a substitution transition to be refused got %s", msg)
+	}
+	if action, _, ok := vasm.NewTimedStateMachine(mm.Net()).Next(); ok {
+		t.Fatalf("expected substitution transition to never be ready got %s", action)
+	}
+
+	n := vasm.ExecuteNested(mm)
+	review := n.Scope("review")
+	fire(t, review, "take", true)
+	if review.TokenCount("pending") != 1 || review.TokenCount("in") != 0 || n.TokenCount("start") != 0 {
+		t.Fatalf("expected token to move into the subnet")
+	}
+	fire(t, n, "review.finish", true)
+	if s := review.GetState(); s[approval.Places["out"].Offset] != 1 || n.TokenCount("done") != 1 {
+		t.Fatalf("expected token to leave through the out port %v", s)
+	}
+}